@@ -1,17 +1,27 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/muverum/usecase/golden"
+	"github.com/muverum/usecase/health"
 	"github.com/muverum/usecase/node"
+	"github.com/muverum/usecase/redact"
+	"github.com/muverum/usecase/rpc"
+	"github.com/muverum/usecase/tlsutil"
 	"github.com/swaggest/openapi-go/openapi3"
 	"github.com/swaggest/rest/openapi"
 	"github.com/swaggest/rest/response/gzip"
 	"github.com/swaggest/rest/web"
-	swgui "github.com/swaggest/swgui/v4emb"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 type API struct {
@@ -21,11 +31,53 @@ type API struct {
 	Middleware []func(next http.Handler) http.Handler
 	Wraps      []func(next http.Handler) http.Handler
 	Actions    map[string]map[string]node.Handler
+	// RPC when set mounts a JSON-RPC 2.0 endpoint for the use cases registered with it
+	RPC *rpc.Server
+	// Batch when set mounts a route dispatching many sub-requests in a single call
+	Batch *Batch
+	// Health when set mounts /healthz and /readyz backed by its checks
+	Health *health.Registry
+	// Recorder when set writes the requests served, with their responses, to golden files for golden.Replay
+	Recorder *golden.Recorder
+	// Versioning when set mounts the Nodes once per version instead of unversioned
+	Versioning *Versioning
+	// TLS when set serves both listeners over TLS
+	TLS *TLSConfig
+	// Docs configures how the documentation is served, by default Swagger UI at /swagger on Ports.Swagger
+	Docs *DocsConfig
+	// Encoders are the media types use case outputs can be negotiated as besides JSON, none by default
+	Encoders *Encoders
+	// Documents are additional OpenAPI documents, each filtered for an audience and served at /swagger/<name>
+	Documents []Document
+	// ShutdownDelay is how long Shutdown keeps serving with readiness failing before it stops the listeners
+	ShutdownDelay time.Duration
 	// Port Defines the listening TCP Port for this when started
 	Ports struct {
 		API     int
 		Swagger int
 	}
+	// Addrs override Ports with listener addresses, host:port or unix:/path/to.sock
+	Addrs struct {
+		API  string
+		Docs string
+	}
+	// Timeouts of the http.Servers started by Listen and Serve, zero meaning none
+	Timeouts struct {
+		Read       time.Duration
+		ReadHeader time.Duration
+		Write      time.Duration
+		Idle       time.Duration
+	}
+	// OnReady is called with the bound addresses once the listeners are being served
+	OnReady func(addresses Addresses)
+
+	options   []func(s *web.Service, initialized bool)
+	mu        sync.Mutex
+	servers   []*http.Server
+	ready     chan struct{}
+	addresses Addresses
+	// mountErrs are the errors of handler wraps, which can't return them, collected while mounting
+	mountErrs []error
 }
 
 func Docs(s chi.Router, pattern string, swgui func(title, schemaURL, basePath string) http.Handler, collector *openapi.Collector, spec *openapi3.Spec) {
@@ -41,8 +93,11 @@ func (a *API) Routes() string {
 	//Top Level Routes first
 	sb.WriteString("-----Top Level Routes -----\n")
 	for route, actionMap := range a.Actions {
-		for verb, _ := range actionMap {
+		for verb, h := range actionMap {
 			sb.WriteString(fmt.Sprintf("%s\t%s", route, verb))
+			if d, ok := h.(node.Described); ok && d.Describe() != "" {
+				sb.WriteString(fmt.Sprintf("\t[%s]", d.Describe()))
+			}
 		}
 	}
 
@@ -54,15 +109,39 @@ func (a *API) Routes() string {
 		sb.WriteString(v.Routes())
 	}
 
+	if a.Versioning != nil {
+		for _, version := range a.Versioning.Versions {
+			sb.WriteString("\n\n")
+			sb.WriteString(fmt.Sprintf("----- Version %s -----\n", version))
+			for _, n := range a.Nodes {
+				for route, v := range n.VersionTree(version) {
+					for verb := range v {
+						sb.WriteString(fmt.Sprintf("\t/%s%s%s\t%s\n", version, n.Root, route, verb))
+					}
+				}
+			}
+		}
+	}
+
+	if a.RPC != nil {
+		sb.WriteString("\n\n")
+		sb.WriteString("----- RPC Methods -----\n")
+		for _, v := range a.RPC.Methods() {
+			sb.WriteString(fmt.Sprintf("%s\t%s\n", a.RPC.Path, v.Name))
+		}
+	}
+
 	return sb.String()
 }
 
 func New(apiPort int, swaggerPort int, options ...func(s *web.Service, initialized bool)) *API {
-
+	options = append([]func(s *web.Service, initialized bool){redactSchemas}, options...)
 	server := web.DefaultService(options...)
 
 	return &API{
-		Server: server,
+		Server:   server,
+		options:  options,
+		Encoders: NewEncoders(),
 		Middleware: []func(next http.Handler) http.Handler{
 			middleware.RequestID,
 			middleware.Logger,
@@ -78,15 +157,38 @@ func New(apiPort int, swaggerPort int, options ...func(s *web.Service, initializ
 	}
 }
 
+// redactSchemas documents the input fields tagged to be redacted as secrets, see redact.InterceptProp
+func redactSchemas(s *web.Service, initialized bool) {
+	if !initialized {
+		return
+	}
+	if r, ok := s.OpenAPIReflector().(*openapi3.Reflector); ok {
+		r.DefaultOptions = append(r.DefaultOptions, redact.InterceptProp)
+	}
+}
+
 func (a *API) MountRoutes() error {
+	if err := a.validateDocuments(); err != nil {
+		return err
+	}
+
 	if len(a.Wraps) > 0 {
 		a.Server.Wrap(a.Wraps...)
 	}
+	a.Server.Wrap(a.negotiate)
 
 	if len(a.Middleware) > 0 {
 		a.Server.Use(a.Middleware...)
 	}
 
+	if a.Recorder != nil {
+		a.Server.Use(a.Recorder.Middleware)
+	}
+
+	if a.TLS != nil {
+		a.Server.Use(tlsutil.Identify)
+	}
+
 	//Mount top level actions
 	for route, v := range a.Actions {
 		for method, h := range v {
@@ -96,27 +198,196 @@ func (a *API) MountRoutes() error {
 
 	//Mount Child Routes
 	var err error
-	for _, v := range a.Nodes {
-		if err = v.Mount(); err != nil {
+	if a.Versioning != nil {
+		if err = a.mountVersions(); err != nil {
 			return err
 		}
+	} else {
+		for _, v := range a.Nodes {
+			if err = v.Mount(); err != nil {
+				return err
+			}
+		}
 	}
 
-	return nil
+	if a.RPC != nil {
+		a.mountRPC()
+	}
+
+	if a.Batch != nil {
+		if err = a.mountBatch(); err != nil {
+			return err
+		}
+	}
+
+	if a.Health != nil {
+		a.Server.Method(http.MethodGet, "/healthz", a.Health.Liveness())
+		a.Server.Method(http.MethodGet, "/readyz", a.Health.Readiness())
+	}
+
+	if a.Docs != nil && a.Docs.SamePort {
+		if err = a.mountDocs(); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(a.mountErrs...)
+}
+
+// mountRPC mounts the RPC server. Only the use cases registered with it are callable, since calls run the
+// use case alone, without the middleware, deprecation, audit and upload limits of its route.
+func (a *API) mountRPC() {
+	if a.RPC.Title == "" && a.Server.OpenAPI != nil {
+		a.RPC.Title = a.Server.OpenAPI.Info.Title
+		a.RPC.Version = a.Server.OpenAPI.Info.Version
+	}
+
+	a.Server.Method(http.MethodPost, a.RPC.Path, a.RPC)
 }
 
+// Listen binds the listeners from Addrs, or from Ports when they're unset, and serves on them
 func (a *API) Listen() error {
+	apiAddress := a.Addrs.API
+	if apiAddress == "" {
+		apiAddress = fmt.Sprintf(":%d", a.Ports.API)
+	}
+	docsAddress := a.Addrs.Docs
+	if docsAddress == "" {
+		docsAddress = fmt.Sprintf(":%d", a.Ports.Swagger)
+	}
+
+	apiListener, err := NewListener(apiAddress)
+	if err != nil {
+		return err
+	}
+
+	var docsListener net.Listener
+	if a.Docs == nil || !a.Docs.SamePort {
+		if docsListener, err = NewListener(docsAddress); err != nil {
+			_ = apiListener.Close()
+			return err
+		}
+	}
+
+	return a.Serve(apiListener, docsListener)
+}
+
+// Serve mounts the routes and serves the API on apiListener and the docs on docsListener, which may be
+// nil when the docs are served on the API listener or not at all. It returns once the API listener is
+// shut down, nil when that was done through Shutdown.
+func (a *API) Serve(apiListener, docsListener net.Listener) (err error) {
+	// The listeners are the API's from here on, so they are closed when it can't serve on them
+	defer func() {
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_ = apiListener.Close()
+			if docsListener != nil {
+				_ = docsListener.Close()
+			}
+		}
+	}()
 
-	var err error
 	if err = a.MountRoutes(); err != nil {
 		return err
 	}
 
-	r := chi.NewRouter()
-	Docs(r, "/swagger", swgui.New, a.Server.OpenAPICollector, a.Server.OpenAPI)
+	var config *tls.Config
+	if a.TLS != nil {
+		if config, err = a.TLS.Config(); err != nil {
+			return err
+		}
+	}
+
+	// Both servers are registered before Ready so that a Shutdown issued from then on stops them
+	addresses := Addresses{API: apiListener.Addr()}
+	var docs *http.Server
+	if docsListener != nil {
+		var h http.Handler
+		if h, err = a.DocsHandler(); err != nil {
+			return err
+		}
+
+		addresses.Docs = docsListener.Addr()
+		docs = a.server(h, config)
+	}
+	apiServer := a.server(a.Server, config)
+
+	a.setReady(addresses)
+
+	// Whichever server fails first stops the other, its error being returned
+	errs := make(chan error, 2)
+	if docs != nil {
+		go func() {
+			if err := serve(docs, docsListener); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("docs server: %w", err)
+			}
+		}()
+	}
 	go func() {
-		_ = http.ListenAndServe(fmt.Sprintf(":%d", a.Ports.Swagger), r)
+		errs <- serve(apiServer, apiListener)
 	}()
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", a.Ports.API), a.Server)
+	err = <-errs
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	_ = apiServer.Close()
+	if docs != nil {
+		_ = docs.Close()
+	}
+
+	return err
+}
+
+func serve(s *http.Server, l net.Listener) error {
+	if s.TLSConfig != nil {
+		return s.ServeTLS(l, "", "")
+	}
+
+	return s.Serve(l)
+}
+
+func (a *API) server(h http.Handler, config *tls.Config) *http.Server {
+	s := &http.Server{
+		Handler:           h,
+		TLSConfig:         config,
+		ReadTimeout:       a.Timeouts.Read,
+		ReadHeaderTimeout: a.Timeouts.ReadHeader,
+		WriteTimeout:      a.Timeouts.Write,
+		IdleTimeout:       a.Timeouts.Idle,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.servers = append(a.servers, s)
+
+	return s
+}
+
+// Shutdown flips readiness to failing, waits ShutdownDelay so that load balancers stop sending traffic
+// and then gracefully stops the listeners, waiting for in-flight requests until ctx is done.
+func (a *API) Shutdown(ctx context.Context) error {
+	if a.Health != nil {
+		a.Health.SetShuttingDown(true)
+	}
+
+	if a.ShutdownDelay > 0 {
+		select {
+		case <-time.After(a.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	a.mu.Lock()
+	servers := a.servers
+	a.mu.Unlock()
+
+	var err error
+	for _, v := range servers {
+		if shutdownErr := v.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+
+	return err
 }
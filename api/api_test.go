@@ -1,23 +1,39 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"github.com/metrumresearchgroup/wrapt"
 	"github.com/muverum/usecase"
 	"github.com/muverum/usecase/example/nodes/dog"
 	usecase2 "github.com/muverum/usecase/example/usecase"
+	"github.com/muverum/usecase/golden"
+	"github.com/muverum/usecase/health"
 	"github.com/muverum/usecase/node"
+	"github.com/muverum/usecase/rpc"
+	"github.com/muverum/usecase/tlsutil"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func testServer() *httptest.Server {
-	api := New(3001, 3000)
+	api := testAPI()
+	_ = api.MountRoutes()
+	return httptest.NewServer(api.Server)
+}
+
+func testAPI() *API {
+	api := New(0, 0)
 
 	logger := log.New(os.Stdout, "EXAMPLE-", 0)
 
@@ -46,8 +62,7 @@ func testServer() *httptest.Server {
 		dognode,
 	}
 
-	_ = api.MountRoutes()
-	return httptest.NewServer(api.Server)
+	return api
 }
 
 func TestAPI_Listen(tt *testing.T) {
@@ -146,3 +161,917 @@ func TestAPI_Listen(tt *testing.T) {
 		})
 	}
 }
+
+func TestAPI_RPC(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	api := testAPI()
+	api.RPC = rpc.New()
+	t.R.Nil(api.RPC.RegisterTitled(api.Actions["/cat"][http.MethodPost].(usecase.Interactor)))
+	t.R.Nil(api.RPC.Register("feedDog", api.Nodes[0].Tree["/feed"][http.MethodPost].(usecase.Interactor)))
+	t.R.Nil(api.MountRoutes())
+
+	server := httptest.NewServer(api.Server)
+	defer server.Close()
+
+	t.A.Contains(api.Routes(), "/rpc\tfeedDog")
+	// Titled use cases aren't exposed without being registered, as RPC calls skip their route's middleware
+	t.A.False(api.RPC.Has("walkDog"))
+
+	body := `[
+		{"jsonrpc":"2.0","method":"concatenateYourRequest","params":{"input":"banana"},"id":1},
+		{"jsonrpc":"2.0","method":"feedDog","params":{"bowls":3},"id":2}
+	]`
+	res, err := http.Post(server.URL+"/rpc", "application/json", strings.NewReader(body))
+	t.R.Nil(err)
+	defer res.Body.Close()
+
+	var out []rpc.Response
+	t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+	t.R.Len(out, 2)
+	t.A.Equal("bananasome-more-text", out[0].Result)
+	t.A.Equal(map[string]any{"happy": true}, out[1].Result)
+}
+
+func TestAPI_Batch(tt *testing.T) {
+	api := testAPI()
+	api.Batch = &Batch{Concurrency: 4, MaxItems: 5}
+	if err := api.MountRoutes(); err != nil {
+		tt.Fatal(err)
+	}
+
+	server := httptest.NewServer(api.Server)
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		body          string
+		assertionFunc func(t *wrapt.T, res *http.Response)
+	}{
+		{
+			name: "items are dispatched through the router",
+			body: `{"items":[
+				{"id":"cat","method":"POST","path":"/cat","body":{"input":"banana"}},
+				{"id":"walk","method":"GET","path":"/dog/walk/atlanta/4"},
+				{"id":"missing","method":"GET","path":"/wtf"},
+				{"id":"feed","method":"POST","path":"/dog/feed","body":{"bowls":1},"dependsOn":["walk"]},
+				{"method":"POST","path":"/dog/feed","body":{"bowls":2},"dependsOn":["missing"]}
+			]}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.R.Equal(http.StatusOK, res.StatusCode)
+
+				var out BatchResponse
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.Len(out.Items, 5)
+
+				t.A.Equal(http.StatusOK, out.Items[0].Status)
+				t.A.JSONEq(`"bananasome-more-text"`, string(out.Items[0].Body))
+				t.A.Equal(http.StatusOK, out.Items[1].Status)
+				t.A.JSONEq(`{"walked":true,"times":4}`, string(out.Items[1].Body))
+				t.A.Contains(out.Items[1].Headers["Content-Type"], "application/json")
+				t.A.Equal(http.StatusNotFound, out.Items[2].Status)
+				t.A.Equal(http.StatusOK, out.Items[3].Status)
+				t.A.JSONEq(`{"happy":false}`, string(out.Items[3].Body))
+				t.A.Equal(http.StatusFailedDependency, out.Items[4].Status)
+			},
+		},
+		{
+			name: "invalid sub-request bodies are reported per item",
+			body: `{"items":[{"method":"POST","path":"/dog/feed","body":{}}]}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out BatchResponse
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.A.Equal(http.StatusBadRequest, out.Items[0].Status)
+			},
+		},
+		{
+			name: "dependency cycles are rejected",
+			body: `{"items":[
+				{"id":"a","method":"GET","path":"/dog/walk/a/1","dependsOn":["b"]},
+				{"id":"b","method":"GET","path":"/dog/walk/b/1","dependsOn":["a"]}
+			]}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusBadRequest, res.StatusCode)
+			},
+		},
+		{
+			name: "batch size is limited",
+			body: `{"items":[` + strings.TrimSuffix(strings.Repeat(`{"method":"GET","path":"/wtf"},`, 6), ",") + `]}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusBadRequest, res.StatusCode)
+			},
+		},
+		{
+			name: "batches can't be nested",
+			body: `{"items":[
+				{"method":"POST","path":"/batch","body":{"items":[]}},
+				{"method":"POST","path":"/batch#x","body":{"items":[]}},
+				{"method":"POST","path":"/batch?x=1","body":{"items":[]}}
+			]}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out BatchResponse
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.Len(out.Items, 3)
+				for _, v := range out.Items {
+					t.A.Equal(http.StatusBadRequest, v.Status)
+					t.A.Contains(string(v.Body), "batches can't be nested")
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			res, err := http.Post(server.URL+"/batch", "application/json", strings.NewReader(test.body))
+			t.R.Nil(err)
+			defer res.Body.Close()
+
+			if test.assertionFunc != nil {
+				test.assertionFunc(t, res)
+			}
+		})
+	}
+
+	tt.Run("refused from within a batch whatever the path", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`{"items":[]}`))
+		req = req.WithContext(context.WithValue(req.Context(), batchRequestKey{}, req))
+		res := httptest.NewRecorder()
+		api.Server.ServeHTTP(res, req)
+		t.A.Equal(http.StatusBadRequest, res.Code)
+		t.A.Contains(res.Body.String(), "batches can't be nested")
+	})
+
+	tt.Run("documented", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+		spec, err := json.Marshal(api.Server.OpenAPI)
+		t.R.Nil(err)
+		t.A.Contains(string(spec), `"/batch"`)
+		t.A.Contains(string(spec), `"ApiBatchRequest"`)
+	})
+}
+
+func TestAPI_Health(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	api := testAPI()
+	api.Health = health.NewRegistry()
+	t.R.Nil(api.Health.Register(health.Check{Name: "dogs", Critical: true, Func: func(ctx context.Context) error {
+		return nil
+	}}))
+	t.R.Nil(api.MountRoutes())
+
+	server := httptest.NewServer(api.Server)
+	defer server.Close()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		res, err := http.Get(server.URL + path)
+		t.R.Nil(err)
+		t.A.Equal(http.StatusOK, res.StatusCode, path)
+		_ = res.Body.Close()
+	}
+
+	t.R.Nil(api.Shutdown(context.Background()))
+
+	res, err := http.Get(server.URL + "/readyz")
+	t.R.Nil(err)
+	defer res.Body.Close()
+	t.A.Equal(http.StatusServiceUnavailable, res.StatusCode)
+
+	var report health.Report
+	t.R.Nil(json.NewDecoder(res.Body).Decode(&report))
+	t.A.Equal(health.StatusFailing, report.Status)
+}
+
+func TestAPI_Recorder(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	dir := tt.TempDir()
+	api := testAPI()
+	api.Recorder = &golden.Recorder{Dir: dir}
+	t.R.Nil(api.MountRoutes())
+
+	server := httptest.NewServer(api.Server)
+	defer server.Close()
+
+	for _, r := range []struct{ method, path, body string }{
+		{method: http.MethodPost, path: "/cat", body: `{"input":"banana"}`},
+		{method: http.MethodPost, path: "/cat", body: `{"input":""}`},
+		{method: http.MethodGet, path: "/dog/walk/atlanta/4"},
+	} {
+		req, err := http.NewRequest(r.method, server.URL+r.path, strings.NewReader(r.body))
+		t.R.Nil(err)
+		req.Header.Set("Content-Type", "application/json")
+		// Compressed responses are recorded as they were before compression
+		req.Header.Set("Accept-Encoding", "gzip")
+		res, err := http.DefaultTransport.RoundTrip(req)
+		t.R.Nil(err)
+		_ = res.Body.Close()
+	}
+
+	cat, err := golden.Load(dir + "/post_cat.json")
+	t.R.Nil(err)
+	t.R.Len(cat, 2)
+	t.A.JSONEq(`"bananasome-more-text"`, string(cat[0].Response.Body.Body))
+	t.A.Equal(http.StatusBadRequest, cat[1].Response.Status)
+
+	_, err = os.Stat(dir + "/get_dog_walk_{place}_{times}.json")
+	t.A.Nil(err)
+
+	replayed := testAPI()
+	t.R.Nil(replayed.MountRoutes())
+	golden.Replay(tt, replayed.Server, dir)
+}
+
+func TestAPI_Versioning(tt *testing.T) {
+	api := testAPI()
+	api.Versioning = &Versioning{Versions: []string{"v1", "v2"}, Default: "v2"}
+	api.Documents = []Document{{Name: "dogs", Nodes: []string{"/dog"}}}
+	// v2 retires the walk route
+	api.Nodes[0].Versions = map[string]map[node.Route]map[string]node.Handler{
+		"v2": {"/walk/{place}/{times}": {http.MethodGet: nil}},
+	}
+	if err := api.MountRoutes(); err != nil {
+		tt.Fatal(err)
+	}
+
+	server := httptest.NewServer(api.Server)
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		path          string
+		headers       map[string]string
+		assertionFunc func(t *wrapt.T, res *http.Response)
+	}{
+		{
+			name: "prefixed v1 keeps the route",
+			path: "/v1/dog/walk/atlanta/2",
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusOK, res.StatusCode)
+				t.A.Equal("v1", res.Header.Get("API-Version"))
+			},
+		},
+		{
+			name: "prefixed v2 override removes the route",
+			path: "/v2/dog/walk/atlanta/2",
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusNotFound, res.StatusCode)
+			},
+		},
+		{
+			name: "unversioned goes to the default",
+			path: "/dog/walk/atlanta/2",
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusNotFound, res.StatusCode)
+				t.A.Equal("v2", res.Header.Get("API-Version"))
+			},
+		},
+		{
+			name:    "unversioned selected by header",
+			path:    "/dog/walk/atlanta/2",
+			headers: map[string]string{"Accept-Version": "v1"},
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusOK, res.StatusCode)
+				var output usecase2.DogWalkResponse
+				t.A.Nil(json.NewDecoder(res.Body).Decode(&output))
+				t.A.Equal(2, output.Times)
+			},
+		},
+		{
+			name:    "unversioned selected by media type",
+			path:    "/dog/walk/atlanta/2",
+			headers: map[string]string{"Accept": "application/vnd.dogs.v1+json"},
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusOK, res.StatusCode)
+			},
+		},
+		{
+			name:    "unknown version is not acceptable",
+			path:    "/dog/walk/atlanta/2",
+			headers: map[string]string{"Accept-Version": "v9"},
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusNotAcceptable, res.StatusCode)
+			},
+		},
+		{
+			name: "unversioned top level actions are unaffected",
+			path: "/cat",
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+test.path, nil)
+			t.R.Nil(err)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			t.R.Nil(err)
+			defer res.Body.Close()
+
+			test.assertionFunc(t, res)
+		})
+	}
+
+	tt.Run("each version is documented separately", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		v1, err := json.Marshal(api.Versioning.Service("v1").OpenAPI)
+		t.R.Nil(err)
+		v2, err := json.Marshal(api.Versioning.Service("v2").OpenAPI)
+		t.R.Nil(err)
+
+		t.A.Contains(string(v1), `"/v1/dog/walk/{place}/{times}"`)
+		t.A.NotContains(string(v2), `/walk/`)
+		t.A.Contains(string(v2), `"/v2/dog/feed"`)
+		t.A.Contains(string(v2), `"version":"v2"`)
+	})
+
+	tt.Run("documents include the operations of every version", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		doc, err := api.Document("dogs")
+		t.R.Nil(err)
+		t.A.Contains(string(doc), `"/v1/dog/walk/{place}/{times}"`)
+		t.A.Contains(string(doc), `"/v2/dog/feed"`)
+		t.A.Contains(string(doc), `"UsecaseDogWalkResponse"`)
+		t.A.NotContains(string(doc), `"/cat"`)
+	})
+}
+
+func TestAPI_Documents(tt *testing.T) {
+	api := testAPI()
+	cat := api.Actions["/cat"][http.MethodPost].(usecase.UseCase[usecase2.ConcatenateRequest, *usecase2.ConcatenateResponse])
+	api.Actions["/admin/cat"] = map[string]node.Handler{
+		http.MethodPost: cat.Visibility(usecase.VisibilityInternal),
+	}
+	api.Nodes[0].Visibility = usecase.VisibilityPartner
+	api.Documents = []Document{
+		{Name: "public", Visibility: []string{usecase.VisibilityPublic}},
+		{Name: "partner", Title: "Partner API", Visibility: []string{usecase.VisibilityPublic, usecase.VisibilityPartner}},
+		{Name: "dogs", Tags: []string{"dog"}},
+		{Name: "feeding", Nodes: []string{"/dog"}, Visibility: []string{usecase.VisibilityPartner}},
+	}
+	if err := api.MountRoutes(); err != nil {
+		tt.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		document      string
+		assertionFunc func(t *wrapt.T, doc string)
+	}{
+		{
+			name:     "public leaves out partner and internal operations",
+			document: "public",
+			assertionFunc: func(t *wrapt.T, doc string) {
+				t.A.Contains(doc, `"/cat"`)
+				t.A.NotContains(doc, `"/admin/cat"`)
+				t.A.NotContains(doc, `/dog/`)
+				t.A.NotContains(doc, `DogWalk`)
+			},
+		},
+		{
+			name:     "partner includes the node",
+			document: "partner",
+			assertionFunc: func(t *wrapt.T, doc string) {
+				t.A.Contains(doc, `"/cat"`)
+				t.A.Contains(doc, `"/dog/feed"`)
+				t.A.Contains(doc, `"Partner API"`)
+				t.A.NotContains(doc, `"/admin/cat"`)
+			},
+		},
+		{
+			name:     "filtered by tag",
+			document: "dogs",
+			assertionFunc: func(t *wrapt.T, doc string) {
+				t.A.Contains(doc, `"/dog/walk/{place}/{times}"`)
+				t.A.NotContains(doc, `"/cat"`)
+				t.A.NotContains(doc, `Concatenate`)
+			},
+		},
+		{
+			name:     "filtered by node and visibility",
+			document: "feeding",
+			assertionFunc: func(t *wrapt.T, doc string) {
+				t.A.Contains(doc, `"/dog/feed"`)
+				t.A.NotContains(doc, `"/cat"`)
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			doc, err := api.Document(test.document)
+			t.R.Nil(err)
+			t.R.True(json.Valid(doc))
+
+			test.assertionFunc(t, string(doc))
+		})
+	}
+
+	tt.Run("documents are exported", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		dir := tt.TempDir()
+		t.R.Nil(api.ExportDocuments(dir))
+		for _, d := range api.Documents {
+			_, err := os.Stat(dir + "/" + d.Name + ".openapi.json")
+			t.A.Nil(err)
+		}
+
+		_, err := api.Document("missing")
+		t.A.NotNil(err)
+	})
+}
+
+func TestAPI_Documents_names(tt *testing.T) {
+	tests := []struct {
+		name       string
+		documents  []Document
+		versioning *Versioning
+		wantErr    string
+	}{
+		{name: "distinct", documents: []Document{{Name: "public"}, {Name: "partner"}}, versioning: &Versioning{Versions: []string{"v1"}}},
+		{name: "empty", documents: []Document{{Tags: []string{"dog"}}}, wantErr: "a document requires a name"},
+		{name: "duplicate", documents: []Document{{Name: "public"}, {Name: "public"}}, wantErr: "more than one document named public"},
+		{name: "version", documents: []Document{{Name: "v1"}}, versioning: &Versioning{Versions: []string{"v1"}}, wantErr: "taken by a version"},
+		{name: "openrpc", documents: []Document{{Name: "openrpc.json"}}, wantErr: "taken by the OpenRPC document"},
+		{name: "path", documents: []Document{{Name: "a/b"}}, wantErr: "must not contain /"},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			api := testAPI()
+			api.Documents = test.documents
+			api.Versioning = test.versioning
+			err := api.MountRoutes()
+			if test.wantErr == "" {
+				t.R.Nil(err)
+				_, err = api.DocsHandler()
+				t.A.Nil(err)
+				return
+			}
+
+			t.R.NotNil(err)
+			t.A.Contains(err.Error(), test.wantErr)
+			_, err = api.DocsHandler()
+			t.A.NotNil(err)
+		})
+	}
+}
+
+func TestAPI_DocsHandler(tt *testing.T) {
+	type request struct {
+		path       string
+		remoteAddr string
+		user       string
+		password   string
+		status     int
+		contains   string
+	}
+
+	tests := []struct {
+		name     string
+		docs     *DocsConfig
+		requests []request
+		wantErr  bool
+	}{
+		{
+			name: "swagger ui by default",
+			requests: []request{
+				{path: "/swagger/openapi.json", status: http.StatusOK, contains: `"/dog/feed"`},
+				{path: "/swagger/", status: http.StatusOK, contains: "swagger-ui"},
+				{path: "/swagger/public/openapi.json", status: http.StatusOK, contains: `"/cat"`},
+			},
+		},
+		{
+			name: "redoc on the api port at a custom path",
+			docs: &DocsConfig{SamePort: true, Path: "/docs/", UI: UIReDoc},
+			requests: []request{
+				{path: "/docs/openapi.json", status: http.StatusOK, contains: `"/dog/feed"`},
+				{path: "/docs", status: http.StatusOK, contains: `"/docs/openapi.json"`},
+				{path: "/docs/public", status: http.StatusOK, contains: `"/docs/public/openapi.json"`},
+				{path: "/swagger/openapi.json", status: http.StatusNotFound},
+				{path: "/cat", status: http.StatusMethodNotAllowed},
+			},
+		},
+		{
+			name: "ui disabled keeps the spec",
+			docs: &DocsConfig{UI: UINone},
+			requests: []request{
+				{path: "/swagger/openapi.json", status: http.StatusOK},
+				{path: "/swagger/", status: http.StatusNotFound},
+			},
+		},
+		{
+			name: "basic auth",
+			docs: &DocsConfig{BasicAuth: map[string]string{"docs": "secret"}},
+			requests: []request{
+				{path: "/swagger/openapi.json", status: http.StatusUnauthorized},
+				{path: "/swagger/openapi.json", user: "docs", password: "wrong", status: http.StatusUnauthorized},
+				{path: "/swagger/openapi.json", user: "docs", password: "secret", status: http.StatusOK},
+			},
+		},
+		{
+			name: "allowlist",
+			docs: &DocsConfig{Allow: []string{"10.0.0.0/8", "192.0.2.7"}},
+			requests: []request{
+				{path: "/swagger/openapi.json", remoteAddr: "10.1.2.3:4000", status: http.StatusOK},
+				{path: "/swagger/openapi.json", remoteAddr: "192.0.2.7:4000", status: http.StatusOK},
+				{path: "/swagger/openapi.json", remoteAddr: "192.0.2.8:4000", status: http.StatusForbidden},
+			},
+		},
+		{
+			name: "documents only leaves out the full spec",
+			docs: &DocsConfig{DocumentsOnly: true, BasicAuth: map[string]string{"partner": "secret"}},
+			requests: []request{
+				{path: "/swagger/openapi.json", user: "partner", password: "secret", status: http.StatusNotFound},
+				{path: "/swagger/", user: "partner", password: "secret", status: http.StatusNotFound},
+				{path: "/swagger/public/openapi.json", user: "partner", password: "secret", status: http.StatusOK, contains: `"/cat"`},
+			},
+		},
+		{
+			name:    "unknown ui",
+			docs:    &DocsConfig{UI: "fancy"},
+			wantErr: true,
+		},
+		{
+			name:    "bad allowlist entry",
+			docs:    &DocsConfig{Allow: []string{"not-an-address"}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			api := testAPI()
+			api.Docs = test.docs
+			api.Documents = []Document{{Name: "public"}}
+			err := api.MountRoutes()
+
+			var h http.Handler = api.Server
+			if err == nil && (test.docs == nil || !test.docs.SamePort) {
+				h, err = api.DocsHandler()
+			}
+			t.R.Equal(test.wantErr, err != nil)
+			if test.wantErr {
+				return
+			}
+
+			for _, v := range test.requests {
+				r := httptest.NewRequest(http.MethodGet, v.path, nil)
+				if v.remoteAddr != "" {
+					r.RemoteAddr = v.remoteAddr
+				}
+				if v.user != "" {
+					r.SetBasicAuth(v.user, v.password)
+				}
+
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, r)
+
+				t.A.Equal(v.status, res.Code, v.path)
+				if v.contains != "" {
+					t.A.Contains(res.Body.String(), v.contains, v.path)
+				}
+			}
+		})
+	}
+}
+
+type whoAmI struct {
+	CommonName string `json:"commonName"`
+}
+
+func TestAPI_TLS(tt *testing.T) {
+	dir := tt.TempDir()
+	ca, err := tlsutil.NewCA("test ca")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if err = os.WriteFile(dir+"/ca.crt", ca.PEM, 0o644); err != nil {
+		tt.Fatal(err)
+	}
+	certPEM, keyPEM, err := ca.Issue("server", "127.0.0.1")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	certFile, keyFile, err := tlsutil.WriteKeyPair(dir, "server", certPEM, keyPEM)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	uc, err := usecase.New(struct{}{}, &whoAmI{}, func(ctx context.Context, input struct{}, output *whoAmI) error {
+		identity, ok := tlsutil.ClientIdentity(ctx)
+		if !ok {
+			return errors.New("no client identity")
+		}
+		output.CommonName = identity.CommonName
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	api := testAPI()
+	api.Actions["/whoami"] = map[string]node.Handler{http.MethodGet: uc}
+	api.TLS = &TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: dir + "/ca.crt"}
+	if err = api.MountRoutes(); err != nil {
+		tt.Fatal(err)
+	}
+	config, err := api.TLS.Config()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(api.Server)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.PEM)
+
+	client := func(commonName string) *http.Client {
+		config := &tls.Config{RootCAs: roots}
+		if commonName != "" {
+			certPEM, keyPEM, err := ca.Issue(commonName)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			pair, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			config.Certificates = []tls.Certificate{pair}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+
+	tt.Run("verified client identity reaches the use case", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		res, err := client("alice").Get(server.URL + "/whoami")
+		t.R.Nil(err)
+		defer res.Body.Close()
+
+		t.A.Equal(http.StatusOK, res.StatusCode)
+		var output whoAmI
+		t.R.Nil(json.NewDecoder(res.Body).Decode(&output))
+		t.A.Equal("alice", output.CommonName)
+	})
+
+	tt.Run("clients without a certificate are refused", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		_, err := client("").Get(server.URL + "/whoami")
+		t.A.NotNil(err)
+	})
+}
+
+func TestAPI_Serve(tt *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(tt *testing.T, api *API) *http.Client
+		assertionFunc func(t *wrapt.T, api *API, client *http.Client, base string)
+	}{
+		{
+			name: "ephemeral ports",
+			setup: func(tt *testing.T, api *API) *http.Client {
+				return http.DefaultClient
+			},
+			assertionFunc: func(t *wrapt.T, api *API, client *http.Client, base string) {
+				t.R.NotNil(api.Addresses().Docs)
+				t.A.NotEqual(api.Addresses().API.String(), api.Addresses().Docs.String())
+
+				res, err := client.Get("http://" + api.Addresses().Docs.String() + "/swagger/openapi.json")
+				t.R.Nil(err)
+				_ = res.Body.Close()
+				t.A.Equal(http.StatusOK, res.StatusCode)
+			},
+		},
+		{
+			name: "unix socket",
+			setup: func(tt *testing.T, api *API) *http.Client {
+				socket := tt.TempDir() + "/api.sock"
+				api.Addrs.API = "unix:" + socket
+				api.Docs = &DocsConfig{SamePort: true}
+				return &http.Client{Transport: &http.Transport{
+					DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+						return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+					},
+				}}
+			},
+			assertionFunc: func(t *wrapt.T, api *API, client *http.Client, base string) {
+				t.A.Equal("unix", api.Addresses().API.Network())
+				t.A.Nil(api.Addresses().Docs)
+
+				res, err := client.Get(base + "/swagger/openapi.json")
+				t.R.Nil(err)
+				_ = res.Body.Close()
+				t.A.Equal(http.StatusOK, res.StatusCode)
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		tt.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			t := wrapt.WrapT(tt)
+
+			api := testAPI()
+			client := test.setup(tt, api)
+
+			var reported Addresses
+			api.OnReady = func(addresses Addresses) {
+				reported = addresses
+			}
+
+			finished := make(chan error)
+			go func() {
+				finished <- api.Listen()
+			}()
+
+			select {
+			case <-api.Ready():
+			case err := <-finished:
+				t.R.Nil(err)
+				t.R.FailNow("listen returned before being ready")
+			}
+			t.A.Equal(api.Addresses(), reported)
+
+			base := "http://" + api.Addresses().API.String()
+			if api.Addresses().API.Network() == "unix" {
+				base = "http://api"
+			}
+
+			res, err := client.Post(base+"/cat", "application/json", strings.NewReader(`{ "input" : "banana"}`))
+			t.R.Nil(err)
+			_ = res.Body.Close()
+			t.A.Equal(http.StatusOK, res.StatusCode)
+
+			test.assertionFunc(t, api, client, base)
+
+			t.R.Nil(api.Shutdown(context.Background()))
+			t.A.Nil(<-finished)
+		})
+	}
+}
+
+// failingListener fails to accept, as a listener whose socket has gone bad would
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+func TestAPI_Serve_lifecycle(tt *testing.T) {
+	tt.Run("shutdown as soon as ready stops both servers", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		for k := 0; k < 20; k++ {
+			api := testAPI()
+			apiListener, err := net.Listen("tcp", "127.0.0.1:0")
+			t.R.Nil(err)
+			docsListener, err := net.Listen("tcp", "127.0.0.1:0")
+			t.R.Nil(err)
+
+			finished := make(chan error, 1)
+			go func() {
+				finished <- api.Serve(apiListener, docsListener)
+			}()
+
+			<-api.Ready()
+			t.R.Nil(api.Shutdown(context.Background()))
+
+			select {
+			case err = <-finished:
+				t.A.Nil(err)
+			case <-time.After(5 * time.Second):
+				t.R.FailNow("serve did not return after shutdown")
+			}
+		}
+	})
+
+	tt.Run("a failing docs server stops the API", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		api := testAPI()
+		apiListener, err := net.Listen("tcp", "127.0.0.1:0")
+		t.R.Nil(err)
+		docsListener, err := net.Listen("tcp", "127.0.0.1:0")
+		t.R.Nil(err)
+
+		finished := make(chan error, 1)
+		go func() {
+			finished <- api.Serve(apiListener, failingListener{docsListener})
+		}()
+
+		select {
+		case err = <-finished:
+			t.R.NotNil(err)
+			t.A.Contains(err.Error(), "docs server: accept failed")
+		case <-time.After(5 * time.Second):
+			t.R.FailNow("serve did not return after the docs server failed")
+		}
+		_, err = apiListener.Accept()
+		t.A.ErrorIs(err, net.ErrClosed)
+	})
+
+	tt.Run("listeners are closed when serving fails to start", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		api := testAPI()
+		api.TLS = &TLSConfig{CertFile: tt.TempDir() + "/missing.pem", KeyFile: tt.TempDir() + "/missing.key"}
+		apiListener, err := net.Listen("tcp", "127.0.0.1:0")
+		t.R.Nil(err)
+		docsListener, err := net.Listen("tcp", "127.0.0.1:0")
+		t.R.Nil(err)
+
+		t.R.NotNil(api.Serve(apiListener, docsListener))
+
+		_, err = apiListener.Accept()
+		t.A.ErrorIs(err, net.ErrClosed)
+		_, err = docsListener.Accept()
+		t.A.ErrorIs(err, net.ErrClosed)
+	})
+}
+
+func TestNewListener(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	path := tt.TempDir() + "/stale.sock"
+	l, err := NewListener("unix:" + path)
+	t.R.Nil(err)
+	// Leave the socket file behind as a crashed process would
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	t.R.Nil(l.Close())
+
+	l, err = NewListener("unix:" + path)
+	t.R.Nil(err)
+	t.R.Nil(l.Close())
+
+	regular := tt.TempDir() + "/regular"
+	t.R.Nil(os.WriteFile(regular, nil, 0o644))
+	_, err = NewListener("unix:" + regular)
+	t.A.NotNil(err)
+}
+
+type signIn struct {
+	User     string `json:"user"`
+	Password string `json:"password" redact:"true"`
+	Card     string `json:"card" redact:"last4"`
+}
+
+type session struct {
+	Token string `json:"token"`
+}
+
+func TestAPI_Redact(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	uc, err := usecase.New(signIn{}, &session{}, func(ctx context.Context, input signIn, output *session) error {
+		return nil
+	}, nil, nil)
+	t.R.Nil(err)
+
+	api := New(0, 0)
+	api.Actions = map[string]map[string]node.Handler{"/sign-in": {http.MethodPost: uc}}
+	t.R.Nil(api.MountRoutes())
+
+	b, err := json.Marshal(api.Server.OpenAPI)
+	t.R.Nil(err)
+
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	t.R.Nil(json.Unmarshal(b, &doc))
+
+	props := doc.Components.Schemas["ApiSignIn"].Properties
+	t.R.NotEmpty(props, string(b))
+	t.A.Equal(true, props["password"]["writeOnly"])
+	t.A.Equal("password", props["password"]["format"])
+	t.A.NotContains(props["card"], "writeOnly")
+	t.A.NotContains(props["user"], "writeOnly")
+	// Named like a secret but sent back to be read
+	t.A.NotContains(doc.Components.Schemas["ApiSession"].Properties["token"], "writeOnly")
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/muverum/usecase"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/rest/nethttp"
+	usecase2 "github.com/swaggest/usecase"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Batch configures a route accepting an array of sub-requests which are dispatched in-process through the
+// API router (and so through all of its middleware) with their individual results returned together.
+type Batch struct {
+	// Path is where the batch route is mounted, defaults to /batch
+	Path string
+	// Concurrency is the maximum number of sub-requests in flight, 1 (the default) runs them in order
+	Concurrency int
+	// MaxItems limits how many sub-requests a single batch may contain, 0 is unlimited
+	MaxItems int
+}
+
+type BatchItem struct {
+	ID        string            `json:"id,omitempty" description:"Identifier for the item, referenced by dependsOn"`
+	Method    string            `json:"method" required:"true" enum:"GET,POST,PUT,PATCH,DELETE"`
+	Path      string            `json:"path" required:"true" pattern:"^/" description:"Path and query of the sub-request"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      json.RawMessage   `json:"body,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty" description:"IDs of items which must succeed before this one is sent"`
+}
+
+type BatchRequest struct {
+	_     struct{}    `title:"BatchRequest"`
+	Items []BatchItem `json:"items" required:"true" minItems:"1"`
+}
+
+type BatchResult struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty" description:"The JSON response body, or a JSON string for other content"`
+}
+
+type BatchResponse struct {
+	Items []BatchResult `json:"items"`
+}
+
+type batchRequestKey struct{}
+
+func (b *Batch) path() string {
+	if b.Path == "" {
+		return "/batch"
+	}
+
+	return b.Path
+}
+
+// mountBatch registers the batch route as a use case of its own so it is documented like any other
+func (a *API) mountBatch() error {
+	uc, err := usecase.New(BatchRequest{}, &BatchResponse{}, a.batch, func(i *usecase2.IOInteractor) {
+		i.SetTitle("Batch")
+		i.SetDescription("Dispatches several requests to this API in a single call")
+		i.SetExpectedErrors(status.InvalidArgument)
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	// The original request is made available to the use case so that its headers are passed on. Items are
+	// dispatched with it in their context, which is how a batch reached from within another is refused
+	// however its path was spelled.
+	a.Server.Method(http.MethodPost, a.Batch.path(), nethttp.WrapHandler(uc.Handler(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Context().Value(batchRequestKey{}) != nil {
+				code, body := rest.Err(status.Wrap(errors.New("batches can't be nested"), status.InvalidArgument))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(code)
+				_ = json.NewEncoder(w).Encode(body)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), batchRequestKey{}, r)))
+		})
+	}))
+
+	return nil
+}
+
+func (a *API) batch(ctx context.Context, input BatchRequest, output *BatchResponse) error {
+	if a.Batch.MaxItems > 0 && len(input.Items) > a.Batch.MaxItems {
+		return status.Wrap(fmt.Errorf("a batch may contain at most %d items", a.Batch.MaxItems), status.InvalidArgument)
+	}
+
+	levels, err := batchLevels(input.Items)
+	if err != nil {
+		return status.Wrap(err, status.InvalidArgument)
+	}
+
+	parent, _ := ctx.Value(batchRequestKey{}).(*http.Request)
+
+	concurrency := a.Batch.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	output.Items = make([]BatchResult, len(input.Items))
+	succeeded := map[string]bool{}
+	slots := make(chan struct{}, concurrency)
+
+	for _, level := range levels {
+		wg := sync.WaitGroup{}
+		for _, k := range level {
+			item := input.Items[k]
+
+			if failed := failedDependency(item, succeeded); failed != "" {
+				output.Items[k] = BatchResult{
+					ID:     item.ID,
+					Status: http.StatusFailedDependency,
+					Body:   errorBody(fmt.Sprintf("dependency %s did not succeed", failed)),
+				}
+				continue
+			}
+
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(k int, item BatchItem) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				output.Items[k] = a.dispatch(ctx, parent, item)
+			}(k, item)
+		}
+		wg.Wait()
+
+		for _, k := range level {
+			if v := output.Items[k]; v.ID != "" && v.Status < http.StatusBadRequest {
+				succeeded[v.ID] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// dispatch serves a single item through the API router and captures the response
+func (a *API) dispatch(ctx context.Context, parent *http.Request, item BatchItem) BatchResult {
+	result := BatchResult{ID: item.ID}
+
+	// The routing state of the batch request itself must not leak into the sub-request
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, nil)
+
+	r, err := http.NewRequestWithContext(ctx, item.Method, item.Path, bytes.NewReader(item.Body))
+	if err != nil {
+		result.Status = http.StatusBadRequest
+		result.Body = errorBody(err.Error())
+		return result
+	}
+	if r.URL.Path == a.Batch.path() {
+		result.Status = http.StatusBadRequest
+		result.Body = errorBody("batches can't be nested")
+		return result
+	}
+
+	// Set as it would be for a server request so that request logging shows the item path
+	r.RequestURI = item.Path
+
+	if parent != nil {
+		r.Header = parent.Header.Clone()
+		r.RemoteAddr = parent.RemoteAddr
+		r.Host = parent.Host
+		r.TLS = parent.TLS
+	}
+	// The recorded bodies are embedded in the batch response, which gets compressed as a whole
+	r.Header.Del("Accept-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = int64(len(item.Body))
+	if len(item.Body) > 0 && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range item.Headers {
+		r.Header.Set(k, v)
+	}
+
+	w := &batchWriter{header: http.Header{}}
+	a.Server.ServeHTTP(w, r)
+
+	result.Status = w.status
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+
+	result.Headers = map[string]string{}
+	for k, v := range w.header {
+		result.Headers[k] = strings.Join(v, ", ")
+	}
+
+	data := bytes.TrimSpace(w.body.Bytes())
+	switch {
+	case len(data) == 0:
+	case json.Valid(data):
+		result.Body = data
+	default:
+		result.Body, _ = json.Marshal(string(data))
+	}
+
+	return result
+}
+
+// batchLevels orders the items so every item comes in a later level than the items it depends on
+func batchLevels(items []BatchItem) ([][]int, error) {
+	index := map[string]int{}
+	for k, v := range items {
+		if v.ID == "" {
+			continue
+		}
+		if _, ok := index[v.ID]; ok {
+			return nil, fmt.Errorf("duplicate item id %s", v.ID)
+		}
+		index[v.ID] = k
+	}
+
+	for _, v := range items {
+		for _, d := range v.DependsOn {
+			if _, ok := index[d]; !ok {
+				return nil, fmt.Errorf("unknown dependency %s", d)
+			}
+		}
+	}
+
+	var levels [][]int
+	placed := make([]bool, len(items))
+	for remaining := len(items); remaining > 0; {
+		var level []int
+		for k, v := range items {
+			if placed[k] {
+				continue
+			}
+
+			ready := true
+			for _, d := range v.DependsOn {
+				if !placed[index[d]] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, k)
+			}
+		}
+
+		if len(level) == 0 {
+			return nil, fmt.Errorf("dependency cycle between items")
+		}
+
+		for _, k := range level {
+			placed[k] = true
+		}
+		remaining -= len(level)
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+func failedDependency(item BatchItem, succeeded map[string]bool) string {
+	for _, d := range item.DependsOn {
+		if !succeeded[d] {
+			return d
+		}
+	}
+
+	return ""
+}
+
+func errorBody(message string) json.RawMessage {
+	data, _ := json.Marshal(map[string]string{"error": message})
+	return data
+}
+
+// batchWriter captures a sub-response
+type batchWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (w *batchWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(b)
+}
+
+func (w *batchWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
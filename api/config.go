@@ -0,0 +1,471 @@
+package api
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/swaggest/rest/web"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Config is the file and environment representation of an API's settings, consumed by NewFromConfig.
+// Keys are the json names of the fields, nested with dots in errors (ports.api) and with underscores
+// in environment variables (API_PORTS_API).
+type Config struct {
+	Ports struct {
+		API  int `json:"api"`
+		Docs int `json:"docs"`
+	} `json:"ports"`
+	Addrs struct {
+		API  string `json:"api"`
+		Docs string `json:"docs"`
+	} `json:"addrs"`
+	Middleware struct {
+		RequestID bool `json:"requestId"`
+		Logger    bool `json:"logger"`
+		Recoverer bool `json:"recoverer"`
+	} `json:"middleware"`
+	Compression bool           `json:"compression"`
+	Timeouts    TimeoutsConfig `json:"timeouts"`
+	CORS        *CORSConfig    `json:"cors"`
+	Docs        *DocsConfig    `json:"docs"`
+	TLS         *TLSConfig     `json:"tls"`
+}
+
+type TimeoutsConfig struct {
+	Read       time.Duration `json:"read"`
+	ReadHeader time.Duration `json:"readHeader"`
+	Write      time.Duration `json:"write"`
+	Idle       time.Duration `json:"idle"`
+	// Request bounds the handling of each request through the context
+	Request       time.Duration `json:"request"`
+	ShutdownDelay time.Duration `json:"shutdownDelay"`
+}
+
+// ConfigError names the key, and where its value came from, of a setting which can't be used
+type ConfigError struct {
+	Key    string
+	Source string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("config %s: %v", e.Key, e.Err)
+	}
+
+	return fmt.Sprintf("config %s (%s): %v", e.Key, e.Source, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultConfig matches what New sets up
+func DefaultConfig() Config {
+	c := Config{Compression: true}
+	c.Ports.API = 8080
+	c.Ports.Docs = 8081
+	c.Middleware.RequestID = true
+	c.Middleware.Logger = true
+	c.Middleware.Recoverer = true
+
+	return c
+}
+
+// LoadConfig starts from DefaultConfig, applies the files in order and then API_ prefixed environment
+// variables, so later files override earlier ones and the environment overrides every file.
+func LoadConfig(files ...string) (Config, error) {
+	c := DefaultConfig()
+	for _, v := range files {
+		if err := c.LoadFile(v); err != nil {
+			return c, err
+		}
+	}
+
+	if err := c.LoadEnv("API", os.Environ()); err != nil {
+		return c, err
+	}
+
+	return c, c.Validate()
+}
+
+// LoadFile applies a YAML or JSON file, only the keys present in it are changed
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// YAML is a superset of JSON so both are read the same way
+	var raw map[string]any
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	return assign(reflect.ValueOf(c).Elem(), raw, "", path)
+}
+
+// LoadEnv applies the variables named prefix_KEY_PATH from environ (KEY=value pairs). Lists are comma
+// separated and maps are comma separated key=value pairs.
+func (c *Config) LoadEnv(prefix string, environ []string) error {
+	env := map[string]string{}
+	for _, v := range environ {
+		if k, value, ok := strings.Cut(v, "="); ok {
+			env[k] = value
+		}
+	}
+
+	return loadEnv(reflect.ValueOf(c).Elem(), strings.ToUpper(prefix), "", env)
+}
+
+func loadEnv(v reflect.Value, name, key string, env map[string]string) error {
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() == reflect.Struct && t != durationType {
+		for i := 0; i < t.NumField(); i++ {
+			tag := jsonName(t.Field(i))
+			if tag == "" {
+				continue
+			}
+
+			// Pointers are only allocated once one of their variables is actually set
+			variable := name + "_" + envName(tag)
+			target := v
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					if !anyEnv(env, variable) {
+						continue
+					}
+					v.Set(reflect.New(t))
+				}
+				target = v.Elem()
+			}
+
+			if err := loadEnv(target.Field(i), variable, join(key, tag), env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	value, ok := env[name]
+	if !ok {
+		return nil
+	}
+
+	raw, err := parseEnv(t, value)
+	if err != nil {
+		return &ConfigError{Key: key, Source: name, Err: err}
+	}
+
+	return assign(v, raw, key, name)
+}
+
+// anyEnv reports whether the variable or any nested below it is set
+func anyEnv(env map[string]string, variable string) bool {
+	for k := range env {
+		if k == variable || strings.HasPrefix(k, variable+"_") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseEnv turns a variable into the value a file would hold for the type
+func parseEnv(t reflect.Type, value string) (any, error) {
+	switch {
+	case t == durationType:
+		return value, nil
+	case t.Kind() == reflect.Bool:
+		return strconv.ParseBool(value)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return strconv.Atoi(value)
+	case t.Kind() == reflect.Slice:
+		var list []any
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		return list, nil
+	case t.Kind() == reflect.Map:
+		m := map[string]any{}
+		for _, v := range strings.Split(value, ",") {
+			k, value, ok := strings.Cut(strings.TrimSpace(v), "=")
+			if !ok {
+				return nil, fmt.Errorf("expected key=value pairs")
+			}
+			m[k] = value
+		}
+		return m, nil
+	default:
+		return value, nil
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// assign sets v from a decoded YAML value, naming the key in any error
+func assign(v reflect.Value, raw any, key, source string) error {
+	fail := func(format string, args ...any) error {
+		return &ConfigError{Key: key, Source: source, Err: fmt.Errorf(format, args...)}
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if raw == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assign(v.Elem(), raw, key, source)
+	}
+
+	switch {
+	case v.Type() == durationType:
+		s, ok := raw.(string)
+		if !ok {
+			return fail("expected a duration such as 30s, got %v", raw)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fail("expected a duration such as 30s, got %q", s)
+		}
+		v.SetInt(int64(d))
+
+	case v.Kind() == reflect.Struct:
+		m, ok := raw.(map[string]any)
+		if !ok {
+			return fail("expected an object, got %v", raw)
+		}
+
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			field, ok := fieldByName(v.Type(), k)
+			if !ok {
+				return &ConfigError{Key: join(key, k), Source: source, Err: fmt.Errorf("unknown key")}
+			}
+			if err := assign(v.FieldByIndex(field.Index), m[k], join(key, k), source); err != nil {
+				return err
+			}
+		}
+
+	case v.Kind() == reflect.String:
+		switch raw.(type) {
+		case map[string]any, []any, nil:
+			return fail("expected a string, got %v", raw)
+		}
+		v.SetString(fmt.Sprint(raw))
+
+	case v.Kind() == reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return fail("expected true or false, got %v", raw)
+		}
+		v.SetBool(b)
+
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		n, ok := raw.(int)
+		if !ok {
+			return fail("expected an integer, got %v", raw)
+		}
+		v.SetInt(int64(n))
+
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		n, ok := raw.(int)
+		if !ok || n < 0 {
+			return fail("expected a positive integer, got %v", raw)
+		}
+		v.SetUint(uint64(n))
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var list []any
+		switch t := raw.(type) {
+		case []any:
+			list = t
+		case string:
+			for _, s := range strings.Split(t, ",") {
+				list = append(list, strings.TrimSpace(s))
+			}
+		default:
+			return fail("expected a list, got %v", raw)
+		}
+
+		s := reflect.MakeSlice(v.Type(), 0, len(list))
+		for k, item := range list {
+			if err := assign(reflect.New(v.Type().Elem()).Elem(), item, fmt.Sprintf("%s[%d]", key, k), source); err != nil {
+				return err
+			}
+			s = reflect.Append(s, reflect.ValueOf(fmt.Sprint(item)).Convert(v.Type().Elem()))
+		}
+		v.Set(s)
+
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.String:
+		m, ok := raw.(map[string]any)
+		if !ok {
+			return fail("expected an object, got %v", raw)
+		}
+		out := reflect.MakeMapWithSize(v.Type(), len(m))
+		for k, item := range m {
+			out.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(fmt.Sprint(item)))
+		}
+		v.Set(out)
+
+	default:
+		return fail("unsupported setting")
+	}
+
+	return nil
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" || !f.IsExported() {
+		return ""
+	}
+
+	return name
+}
+
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); jsonName(f) == name {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func join(key, name string) string {
+	if key == "" {
+		return name
+	}
+
+	return key + "." + name
+}
+
+// envName turns a camelCase key into its UPPER_SNAKE variable name
+func envName(key string) string {
+	sb := strings.Builder{}
+	for k, r := range key {
+		if k > 0 && unicode.IsUpper(r) && !unicode.IsUpper(rune(key[k-1])) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+
+	return sb.String()
+}
+
+// Validate checks the settings which can be known to be wrong before anything is started
+func (c Config) Validate() error {
+	// Checked in the order of the keys so that the same error is reported every time
+	for _, v := range []struct {
+		key  string
+		port int
+	}{{"ports.api", c.Ports.API}, {"ports.docs", c.Ports.Docs}} {
+		if v.port < 0 || v.port > 65535 {
+			return &ConfigError{Key: v.key, Err: fmt.Errorf("must be between 0 and 65535, got %d", v.port)}
+		}
+	}
+
+	for _, v := range []struct {
+		key string
+		d   time.Duration
+	}{
+		{"timeouts.read", c.Timeouts.Read}, {"timeouts.readHeader", c.Timeouts.ReadHeader}, {"timeouts.write", c.Timeouts.Write},
+		{"timeouts.idle", c.Timeouts.Idle}, {"timeouts.request", c.Timeouts.Request}, {"timeouts.shutdownDelay", c.Timeouts.ShutdownDelay},
+	} {
+		if v.d < 0 {
+			return &ConfigError{Key: v.key, Err: fmt.Errorf("must not be negative")}
+		}
+	}
+
+	if c.Docs != nil {
+		if _, err := c.Docs.ui(); err != nil {
+			return &ConfigError{Key: "docs.ui", Err: fmt.Errorf("must be one of %s, %s or %s", UISwagger, UIReDoc, UINone)}
+		}
+		if _, err := c.Docs.protect(); err != nil {
+			return &ConfigError{Key: "docs.allow", Err: err}
+		}
+	}
+
+	if c.TLS != nil {
+		if c.TLS.CertFile == "" {
+			return &ConfigError{Key: "tls.certFile", Err: fmt.Errorf("is required")}
+		}
+		if c.TLS.KeyFile == "" {
+			return &ConfigError{Key: "tls.keyFile", Err: fmt.Errorf("is required")}
+		}
+	}
+
+	if c.CORS != nil && len(c.CORS.AllowedOrigins) == 0 {
+		return &ConfigError{Key: "cors.allowedOrigins", Err: fmt.Errorf("is required")}
+	}
+	if c.CORS != nil && c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		return &ConfigError{Key: "cors.allowCredentials", Err: fmt.Errorf("can't be combined with the * origin")}
+	}
+
+	return nil
+}
+
+// NewFromConfig creates an API set up as described by the config
+func NewFromConfig(c Config, options ...func(s *web.Service, initialized bool)) (*API, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	a := New(c.Ports.API, c.Ports.Docs, options...)
+	a.Addrs.API = c.Addrs.API
+	a.Addrs.Docs = c.Addrs.Docs
+
+	a.Middleware = nil
+	if c.Middleware.RequestID {
+		a.Middleware = append(a.Middleware, middleware.RequestID)
+	}
+	if c.Middleware.Logger {
+		a.Middleware = append(a.Middleware, middleware.Logger)
+	}
+	if c.Middleware.Recoverer {
+		a.Middleware = append(a.Middleware, middleware.Recoverer)
+	}
+	if c.CORS != nil {
+		a.Middleware = append(a.Middleware, c.CORS.Middleware)
+	}
+	if c.Timeouts.Request > 0 {
+		a.Middleware = append(a.Middleware, middleware.Timeout(c.Timeouts.Request))
+	}
+
+	if !c.Compression {
+		a.Wraps = nil
+	}
+
+	a.Timeouts.Read = c.Timeouts.Read
+	a.Timeouts.ReadHeader = c.Timeouts.ReadHeader
+	a.Timeouts.Write = c.Timeouts.Write
+	a.Timeouts.Idle = c.Timeouts.Idle
+	a.ShutdownDelay = c.Timeouts.ShutdownDelay
+	a.Docs = c.Docs
+	a.TLS = c.TLS
+
+	return a, nil
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+	"github.com/metrumresearchgroup/wrapt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(tt *testing.T, name, content string) string {
+	path := filepath.Join(tt.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		tt.Fatal(err)
+	}
+
+	return path
+}
+
+func TestConfig_Load(tt *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		env           []string
+		assertionFunc func(t *wrapt.T, c Config, err error)
+	}{
+		{
+			name: "yaml then json then environment",
+			files: map[string]string{
+				"1.yaml": `
+ports:
+  api: 9000
+  docs: 9001
+compression: false
+timeouts:
+  read: 5s
+  shutdownDelay: 2s
+docs:
+  path: /docs
+  basicAuth:
+    admin: secret
+`,
+				"2.json": `{"ports": {"docs": 9100}, "docs": {"ui": "redoc"}}`,
+			},
+			env: []string{"API_PORTS_API=9200", "API_CORS_ALLOWED_ORIGINS=https://a.example, https://b.example", "API_MIDDLEWARE_LOGGER=false", "UNRELATED=1"},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				t.R.Nil(err)
+				t.A.Equal(9200, c.Ports.API)
+				t.A.Equal(9100, c.Ports.Docs)
+				t.A.False(c.Compression)
+				t.A.Equal(5*time.Second, c.Timeouts.Read)
+				t.A.Equal(2*time.Second, c.Timeouts.ShutdownDelay)
+				t.R.NotNil(c.Docs)
+				t.A.Equal("/docs", c.Docs.Path)
+				t.A.Equal(UIReDoc, c.Docs.UI)
+				t.A.Equal(map[string]string{"admin": "secret"}, c.Docs.BasicAuth)
+				t.R.NotNil(c.CORS)
+				t.A.Equal([]string{"https://a.example", "https://b.example"}, c.CORS.AllowedOrigins)
+				t.A.False(c.Middleware.Logger)
+				t.A.True(c.Middleware.Recoverer)
+				t.A.Nil(c.TLS)
+			},
+		},
+		{
+			name:  "unknown keys are named",
+			files: map[string]string{"1.yaml": "docs:\n  uii: redoc\n"},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				var configErr *ConfigError
+				t.R.True(errors.As(err, &configErr))
+				t.A.Equal("docs.uii", configErr.Key)
+				t.A.Contains(err.Error(), "unknown key")
+				t.A.Contains(err.Error(), "1.yaml")
+			},
+		},
+		{
+			name:  "wrong types are named",
+			files: map[string]string{"1.json": `{"ports": {"api": "eighty"}}`},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				var configErr *ConfigError
+				t.R.True(errors.As(err, &configErr))
+				t.A.Equal("ports.api", configErr.Key)
+			},
+		},
+		{
+			name: "bad environment values name the variable",
+			env:  []string{"API_TIMEOUTS_READ_HEADER=soon"},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				var configErr *ConfigError
+				t.R.True(errors.As(err, &configErr))
+				t.A.Equal("timeouts.readHeader", configErr.Key)
+				t.A.Equal("API_TIMEOUTS_READ_HEADER", configErr.Source)
+			},
+		},
+		{
+			name:  "validation names the key",
+			files: map[string]string{"1.yaml": "ports:\n  api: 70000\n"},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				t.R.NotNil(err)
+				t.A.Equal("config ports.api: must be between 0 and 65535, got 70000", err.Error())
+			},
+		},
+		{
+			name:  "validation reports the first key in order",
+			files: map[string]string{"1.yaml": "ports:\n  api: -1\n  docs: -1\ntimeouts:\n  idle: -1s\n  read: -1s\n"},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				var configErr *ConfigError
+				t.R.True(errors.As(err, &configErr))
+				t.A.Equal("ports.api", configErr.Key)
+
+				c.Ports.API, c.Ports.Docs = 0, 0
+				t.R.True(errors.As(c.Validate(), &configErr))
+				t.A.Equal("timeouts.read", configErr.Key)
+			},
+		},
+		{
+			name: "credentials can't be allowed to any origin",
+			env:  []string{"API_CORS_ALLOWED_ORIGINS=*", "API_CORS_ALLOW_CREDENTIALS=true"},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				var configErr *ConfigError
+				t.R.True(errors.As(err, &configErr))
+				t.A.Equal("cors.allowCredentials", configErr.Key)
+			},
+		},
+		{
+			name: "tls requires both files",
+			env:  []string{"API_TLS_CERT_FILE=server.crt"},
+			assertionFunc: func(t *wrapt.T, c Config, err error) {
+				t.R.NotNil(err)
+				t.A.Contains(err.Error(), "tls.keyFile")
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			c := DefaultConfig()
+			var err error
+			for _, name := range []string{"1.yaml", "1.json", "2.json"} {
+				if content, ok := test.files[name]; ok && err == nil {
+					err = c.LoadFile(writeConfig(tt, name, content))
+				}
+			}
+			if err == nil {
+				err = c.LoadEnv("API", test.env)
+			}
+			if err == nil {
+				err = c.Validate()
+			}
+
+			test.assertionFunc(t, c, err)
+		})
+	}
+}
+
+func TestNewFromConfig(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	c := DefaultConfig()
+	c.Compression = false
+	c.Middleware.Logger = false
+	c.CORS = &CORSConfig{AllowedOrigins: []string{"https://app.example"}, MaxAge: 600}
+	c.Timeouts.Idle = time.Minute
+
+	api, err := NewFromConfig(c)
+	t.R.Nil(err)
+	t.A.Nil(api.Wraps)
+	t.A.Len(api.Middleware, 3)
+	t.A.Equal(time.Minute, api.Timeouts.Idle)
+
+	api.Actions = testAPI().Actions
+	t.R.Nil(api.MountRoutes())
+
+	r := httptest.NewRequest(http.MethodOptions, "/cat", nil)
+	r.Header.Set("Origin", "https://app.example")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	res := httptest.NewRecorder()
+	api.Server.ServeHTTP(res, r)
+	t.A.Equal(http.StatusNoContent, res.Code)
+	t.A.Equal("https://app.example", res.Header().Get("Access-Control-Allow-Origin"))
+	t.A.Equal("600", res.Header().Get("Access-Control-Max-Age"))
+
+	r = httptest.NewRequest(http.MethodOptions, "/cat", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	res = httptest.NewRecorder()
+	api.Server.ServeHTTP(res, r)
+	t.A.Empty(res.Header().Get("Access-Control-Allow-Origin"))
+
+	c.Docs = &DocsConfig{UI: "fancy"}
+	_, err = NewFromConfig(c)
+	t.A.NotNil(err)
+}
+
+func TestCORSConfig_Middleware(tt *testing.T) {
+	tests := []struct {
+		name            string
+		cors            CORSConfig
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{
+			name:            "listed origins get credentials",
+			cors:            CORSConfig{AllowedOrigins: []string{"https://app.example", "*"}, AllowCredentials: true},
+			origin:          "https://app.example",
+			wantOrigin:      "https://app.example",
+			wantCredentials: "true",
+		},
+		{
+			name:       "the wildcard never gets credentials",
+			cors:       CORSConfig{AllowedOrigins: []string{"https://app.example", "*"}, AllowCredentials: true},
+			origin:     "https://evil.example",
+			wantOrigin: "*",
+		},
+		{
+			name:   "other origins get nothing",
+			cors:   CORSConfig{AllowedOrigins: []string{"https://app.example"}, AllowCredentials: true},
+			origin: "https://evil.example",
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			h := test.cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/cat", nil)
+			r.Header.Set("Origin", test.origin)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, r)
+
+			t.A.Equal(test.wantOrigin, res.Header().Get("Access-Control-Allow-Origin"))
+			t.A.Equal(test.wantCredentials, res.Header().Get("Access-Control-Allow-Credentials"))
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig allows browsers on other origins to call the API
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed, * allowing any without credentials
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// AllowedMethods defaults to GET, POST, PUT, PATCH and DELETE
+	AllowedMethods []string `json:"allowedMethods"`
+	AllowedHeaders []string `json:"allowedHeaders"`
+	ExposedHeaders []string `json:"exposedHeaders"`
+	// AllowCredentials applies to the origins listed explicitly, it can't be combined with *
+	AllowCredentials bool `json:"allowCredentials"`
+	// MaxAge is how many seconds a preflight response may be cached
+	MaxAge int `json:"maxAge"`
+}
+
+// allowed reports whether the origin is allowed, and whether only through the * wildcard
+func (c *CORSConfig) allowed(origin string) (ok, wildcard bool) {
+	for _, v := range c.AllowedOrigins {
+		if strings.EqualFold(v, origin) {
+			return true, false
+		}
+		if v == "*" {
+			wildcard = true
+		}
+	}
+
+	return wildcard, wildcard
+}
+
+// Middleware answers preflight requests and adds the CORS headers for allowed origins
+func (c *CORSConfig) Middleware(next http.Handler) http.Handler {
+	methods := c.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		ok, wildcard := c.allowed(origin)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Origins only allowed through the wildcard never get credentials, which would let any site make
+		// requests on behalf of the user
+		if wildcard {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if c.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			if len(c.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Preflight
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(c.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+		} else if h := r.Header.Get("Access-Control-Request-Headers"); h != "" {
+			w.Header().Set("Access-Control-Allow-Headers", h)
+		}
+		if c.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
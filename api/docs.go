@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	swgui "github.com/swaggest/swgui/v4emb"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// UISwagger serves Swagger UI, the default
+	UISwagger = "swagger"
+	// UIReDoc serves a bundled single page reference renderer in the style of ReDoc
+	UIReDoc = "redoc"
+	// UINone serves only the JSON documents
+	UINone = "none"
+)
+
+// DocsConfig controls where and how the OpenAPI documents and their UI are served
+type DocsConfig struct {
+	// SamePort serves the docs from the API listener instead of on Ports.Swagger
+	SamePort bool `json:"samePort"`
+	// Path is the base path of the docs, defaults to /swagger
+	Path string `json:"path"`
+	// UI is one of UISwagger, UIReDoc or UINone
+	UI string `json:"ui"`
+	// BasicAuth when set requires one of the username -> password pairs
+	BasicAuth map[string]string `json:"basicAuth"`
+	// Allow when set restricts the docs to clients within the CIDRs (or single addresses)
+	Allow []string `json:"allow"`
+	// DocumentsOnly serves only the audience specific Documents, leaving out the full documents of the API
+	// and its versions as well as the OpenRPC document
+	DocumentsOnly bool `json:"documentsOnly"`
+}
+
+//go:embed docs.html
+var reDocPage string
+
+var reDocTemplate = template.Must(template.New("docs").Parse(reDocPage))
+
+func (c *DocsConfig) path() string {
+	if c == nil || c.Path == "" {
+		return "/swagger"
+	}
+
+	return "/" + strings.Trim(c.Path, "/")
+}
+
+func (c *DocsConfig) ui() (func(title, schemaURL, basePath string) http.Handler, error) {
+	if c == nil {
+		return swgui.New, nil
+	}
+
+	switch c.UI {
+	case "", UISwagger:
+		return swgui.New, nil
+	case UIReDoc:
+		return ReDoc, nil
+	case UINone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown docs ui %s", c.UI)
+	}
+}
+
+// ReDoc renders an OpenAPI document as a single page reference, with the operations grouped by tag
+func ReDoc(title, schemaURL, basePath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = reDocTemplate.Execute(w, struct {
+			Title     string
+			SchemaURL string
+		}{title, schemaURL})
+	})
+}
+
+// DocsHandler serves every document of the API below the docs path: the API's own, one per version,
+// the audience specific Documents and the OpenRPC document, protected as configured. With DocumentsOnly
+// only the Documents are served.
+func (a *API) DocsHandler() (http.Handler, error) {
+	if err := a.validateDocuments(); err != nil {
+		return nil, err
+	}
+
+	ui, err := a.Docs.ui()
+	if err != nil {
+		return nil, err
+	}
+
+	protect, err := a.Docs.protect()
+	if err != nil {
+		return nil, err
+	}
+
+	base := a.Docs.path()
+	r := chi.NewRouter()
+	r.Use(protect)
+
+	mount := func(pattern, title string, spec http.Handler) {
+		r.Method(http.MethodGet, pattern+"/openapi.json", spec)
+		if ui != nil {
+			r.Mount(pattern, ui(title, pattern+"/openapi.json", pattern))
+		}
+	}
+
+	full := a.Docs == nil || !a.Docs.DocumentsOnly
+	if full {
+		mount(base, a.Server.OpenAPI.Info.Title, a.Server.OpenAPICollector)
+	}
+	if full && a.Versioning != nil {
+		for _, version := range a.Versioning.Versions {
+			s := a.Versioning.Service(version)
+			mount(base+"/"+version, s.OpenAPI.Info.Title, s.OpenAPICollector)
+		}
+	}
+	for _, d := range a.Documents {
+		title := d.Title
+		if title == "" {
+			title = a.Server.OpenAPI.Info.Title
+		}
+		mount(base+"/"+d.Name, title, a.documentHandler(d.Name))
+	}
+	if full && a.RPC != nil {
+		r.Method(http.MethodGet, base+"/openrpc.json", a.RPC.OpenRPCHandler())
+	}
+
+	return r, nil
+}
+
+// mountDocs serves the docs from the API server, the docs router matching on the full path by itself
+func (a *API) mountDocs() error {
+	h, err := a.DocsHandler()
+	if err != nil {
+		return err
+	}
+
+	h = standalone(h)
+	a.Server.Handle(a.Docs.path(), h)
+	a.Server.Handle(a.Docs.path()+"/*", h)
+
+	return nil
+}
+
+func (c *DocsConfig) protect() (func(next http.Handler) http.Handler, error) {
+	var networks []*net.IPNet
+	if c != nil {
+		for _, v := range c.Allow {
+			if !strings.Contains(v, "/") {
+				if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+					v += "/32"
+				} else {
+					v += "/128"
+				}
+			}
+
+			_, network, err := net.ParseCIDR(v)
+			if err != nil {
+				return nil, fmt.Errorf("docs allow %s: %w", v, err)
+			}
+			networks = append(networks, network)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(networks) > 0 && !allowed(networks, r.RemoteAddr) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			if c != nil && len(c.BasicAuth) > 0 {
+				user, password, ok := r.BasicAuth()
+				expected, known := c.BasicAuth[user]
+				if !ok || !known || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+					w.Header().Set("WWW-Authenticate", `Basic realm="docs", charset="UTF-8"`)
+					http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func allowed(networks []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, v := range networks {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// standalone serves a request with a router which routes on the full path rather than continuing
+// from the routing state of the API server
+func standalone(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, nil)))
+	})
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/muverum/usecase"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Document is a named OpenAPI document holding the subset of the API's operations meant for an audience.
+// An operation is included when it matches every criterion which is set.
+type Document struct {
+	Name string
+	// Title replaces the title of the API's document when set
+	Title string
+	// Tags includes operations carrying any of the tags
+	Tags []string
+	// Nodes includes operations under any of the node roots
+	Nodes []string
+	// Visibility includes operations with any of the visibilities, operations without one are public
+	Visibility []string
+}
+
+var methods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true, "options": true, "head": true, "patch": true, "trace": true,
+}
+
+// Filter returns the JSON document for spec reduced to the operations matching the document.
+// Component schemas which are no longer referenced are dropped so nothing about excluded
+// operations can be read from it.
+func (d Document) Filter(spec any) ([]byte, error) {
+	return d.filter(spec, nil)
+}
+
+// versionSpec is the spec of the service a version's nodes are mounted on
+type versionSpec struct {
+	version string
+	spec    any
+}
+
+// filter is Filter with the matching operations of the version specs merged in, their node roots
+// being matched below the version prefix
+func (d Document) filter(spec any, versions []versionSpec) ([]byte, error) {
+	doc, err := decodeSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	d.filterPaths(doc, "")
+
+	for _, v := range versions {
+		versioned, err := decodeSpec(v.spec)
+		if err != nil {
+			return nil, err
+		}
+		d.filterPaths(versioned, "/"+v.version)
+		mergeSpec(doc, versioned)
+	}
+
+	if d.Title != "" {
+		if info, ok := doc["info"].(map[string]any); ok {
+			info["title"] = d.Title
+		}
+	}
+
+	pruneSchemas(doc)
+
+	return json.MarshalIndent(doc, "", " ")
+}
+
+func decodeSpec(spec any) (map[string]any, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// filterPaths removes the operations which don't match the document, and the paths left without any
+func (d Document) filterPaths(doc map[string]any, prefix string) {
+	paths, _ := doc["paths"].(map[string]any)
+	for path, v := range paths {
+		item, _ := v.(map[string]any)
+		operations := 0
+		for method, op := range item {
+			if !methods[method] {
+				continue
+			}
+			if o, ok := op.(map[string]any); !ok || !d.matches(strings.TrimPrefix(path, prefix), o) {
+				delete(item, method)
+				continue
+			}
+			operations++
+		}
+		if operations == 0 {
+			delete(paths, path)
+		}
+	}
+}
+
+// mergeSpec adds the paths and components of from which doc doesn't have yet
+func mergeSpec(doc, from map[string]any) {
+	merge := func(parent map[string]any, key string, entries map[string]any) {
+		into, ok := parent[key].(map[string]any)
+		if !ok {
+			into = map[string]any{}
+			parent[key] = into
+		}
+		for k, v := range entries {
+			if _, exists := into[k]; !exists {
+				into[k] = v
+			}
+		}
+	}
+
+	if paths, ok := from["paths"].(map[string]any); ok {
+		merge(doc, "paths", paths)
+	}
+
+	components, _ := from["components"].(map[string]any)
+	for kind, v := range components {
+		entries, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		if _, ok := doc["components"].(map[string]any); !ok {
+			doc["components"] = map[string]any{}
+		}
+		merge(doc["components"].(map[string]any), kind, entries)
+	}
+}
+
+func (d Document) matches(path string, op map[string]any) bool {
+	if len(d.Tags) > 0 {
+		tags, _ := op["tags"].([]any)
+		found := false
+		for _, t := range tags {
+			if contains(d.Tags, fmt.Sprint(t)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(d.Nodes) > 0 {
+		found := false
+		for _, root := range d.Nodes {
+			if path == root || strings.HasPrefix(path, strings.TrimRight(root, "/")+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(d.Visibility) > 0 {
+		visibility, _ := op[usecase.VisibilityExtension].(string)
+		if visibility == "" {
+			visibility = usecase.VisibilityPublic
+		}
+		if !contains(d.Visibility, visibility) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pruneSchemas removes the component schemas which can't be reached from the remaining paths
+func pruneSchemas(doc map[string]any) {
+	components, _ := doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	if len(schemas) == 0 {
+		return
+	}
+
+	const prefix = "#/components/schemas/"
+	reachable := map[string]bool{}
+	var walk func(v any)
+	walk = func(v any) {
+		switch t := v.(type) {
+		case map[string]any:
+			if ref, ok := t["$ref"].(string); ok && strings.HasPrefix(ref, prefix) {
+				name := strings.TrimPrefix(ref, prefix)
+				if !reachable[name] {
+					reachable[name] = true
+					walk(schemas[name])
+				}
+			}
+			for _, child := range t {
+				walk(child)
+			}
+		case []any:
+			for _, child := range t {
+				walk(child)
+			}
+		}
+	}
+	walk(doc["paths"])
+
+	for name := range schemas {
+		if !reachable[name] {
+			delete(schemas, name)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Document renders the named document from the API's OpenAPI spec, along with those of its versions
+func (a *API) Document(name string) ([]byte, error) {
+	var versions []versionSpec
+	if a.Versioning != nil {
+		for _, version := range a.Versioning.Versions {
+			if s := a.Versioning.Service(version); s != nil {
+				versions = append(versions, versionSpec{version: version, spec: s.OpenAPI})
+			}
+		}
+	}
+
+	for _, d := range a.Documents {
+		if d.Name == name {
+			return d.filter(a.Server.OpenAPI, versions)
+		}
+	}
+
+	return nil, fmt.Errorf("no document named %s", name)
+}
+
+// validateDocuments rejects document names which would collide with one another, with a version or with
+// the OpenRPC document below the docs path, or which aren't a single path segment
+func (a *API) validateDocuments() error {
+	names := map[string]bool{}
+	for _, d := range a.Documents {
+		switch {
+		case d.Name == "":
+			return fmt.Errorf("a document requires a name")
+		case strings.Contains(d.Name, "/"):
+			return fmt.Errorf("document name %s must not contain /", d.Name)
+		case names[d.Name]:
+			return fmt.Errorf("there is more than one document named %s", d.Name)
+		case d.Name == "openrpc.json":
+			return fmt.Errorf("document name %s is taken by the OpenRPC document", d.Name)
+		case a.Versioning != nil && a.Versioning.has(d.Name):
+			return fmt.Errorf("document name %s is taken by a version", d.Name)
+		}
+		names[d.Name] = true
+	}
+
+	return nil
+}
+
+// ExportDocuments writes every document to dir as <name>.openapi.json
+func (a *API) ExportDocuments(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, d := range a.Documents {
+		data, err := a.Document(d.Name)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(filepath.Join(dir, d.Name+".openapi.json"), data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *API) documentHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := a.Document(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
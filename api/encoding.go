@@ -0,0 +1,583 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/muverum/usecase"
+	"github.com/swaggest/openapi-go"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/rest/nethttp"
+	usecase2 "github.com/swaggest/usecase"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MediaTypeJSON = "application/json"
+	MediaTypeCSV  = "text/csv"
+	MediaTypeXML  = "application/xml"
+)
+
+// Encoder writes use case outputs as a media type other than JSON, which swaggest encodes itself
+type Encoder interface {
+	MediaType() string
+	// Supports reports whether outputs of the type can be encoded, the type being that of the use case
+	// output with the pointer removed
+	Supports(t reflect.Type) bool
+	Encode(w io.Writer, v any) error
+}
+
+// Encoders is the registry of the media types use case outputs can be negotiated as with Accept, JSON
+// always being available unless a use case Produces otherwise
+type Encoders struct {
+	encoders []Encoder
+}
+
+// NewEncoders creates a registry of the encoders, such as NewEncoders(CSV{}, XML{}); outputs are only
+// encoded as JSON without any
+func NewEncoders(encoders ...Encoder) *Encoders {
+	e := &Encoders{}
+	e.Register(encoders...)
+
+	return e
+}
+
+// Register adds the encoders, replacing any already registered for the same media type
+func (e *Encoders) Register(encoders ...Encoder) {
+	for _, encoder := range encoders {
+		replaced := false
+		for k, v := range e.encoders {
+			if v.MediaType() == encoder.MediaType() {
+				e.encoders[k] = encoder
+				replaced = true
+			}
+		}
+		if !replaced {
+			e.encoders = append(e.encoders, encoder)
+		}
+	}
+}
+
+// Get returns the encoder of the media type
+func (e *Encoders) Get(mediaType string) (Encoder, bool) {
+	if e == nil {
+		return nil, false
+	}
+
+	for _, v := range e.encoders {
+		if v.MediaType() == mediaType {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+// MediaTypes lists the media types outputs of the type can be encoded as, JSON first
+func (e *Encoders) MediaTypes(t reflect.Type) []string {
+	mediaTypes := []string{MediaTypeJSON}
+	if e == nil {
+		return mediaTypes
+	}
+
+	for _, v := range e.encoders {
+		if t != nil && v.Supports(t) {
+			mediaTypes = append(mediaTypes, v.MediaType())
+		}
+	}
+
+	return mediaTypes
+}
+
+type encoderFunc struct {
+	mediaType string
+	encode    func(w io.Writer, v any) error
+}
+
+func (e encoderFunc) MediaType() string {
+	return e.mediaType
+}
+
+func (e encoderFunc) Supports(t reflect.Type) bool {
+	return true
+}
+
+func (e encoderFunc) Encode(w io.Writer, v any) error {
+	return e.encode(w, v)
+}
+
+// EncoderFunc makes an Encoder of a marshalling func which handles any output, such as MessagePack's
+func EncoderFunc(mediaType string, encode func(w io.Writer, v any) error) Encoder {
+	return encoderFunc{mediaType: mediaType, encode: encode}
+}
+
+// CSV encodes slice outputs as a header row and a row per element. The columns of struct elements are
+// their exported fields named by their json tags, the fields of embedded structs included.
+type CSV struct{}
+
+func (CSV) MediaType() string {
+	return MediaTypeCSV
+}
+
+func (CSV) Supports(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	return elem.Kind() == reflect.Struct || scalar(elem)
+}
+
+func (c CSV) Encode(w io.Writer, v any) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if !c.Supports(rv.Type()) {
+		return fmt.Errorf("csv can't encode %s", rv.Type())
+	}
+
+	elem := rv.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	out := csv.NewWriter(w)
+	if elem.Kind() != reflect.Struct || elem == reflect.TypeOf(time.Time{}) {
+		if err := out.Write([]string{"value"}); err != nil {
+			return err
+		}
+		for k := 0; k < rv.Len(); k++ {
+			if err := out.Write([]string{cell(rv.Index(k))}); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		return out.Error()
+	}
+
+	columns := csvColumns(elem, nil)
+	header := make([]string, len(columns))
+	for k, v := range columns {
+		header[k] = v.name
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for k := 0; k < rv.Len(); k++ {
+		row := reflect.Indirect(rv.Index(k))
+		record := make([]string, len(columns))
+		for n, column := range columns {
+			if row.IsValid() {
+				if field, err := row.FieldByIndexErr(column.index); err == nil {
+					record[n] = cell(field)
+				}
+			}
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+func csvColumns(t reflect.Type, index []int) []csvColumn {
+	var columns []csvColumn
+	for k := 0; k < t.NumField(); k++ {
+		field := t.Field(k)
+		at := append(append([]int{}, index...), k)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			columns = append(columns, csvColumns(ft, at)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name: name, index: at})
+	}
+
+	return columns
+}
+
+func scalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return t == reflect.TypeOf(time.Time{})
+}
+
+// cell formats a value for a CSV cell: text marshallers as their text, scalars as they print and
+// anything else as JSON
+func cell(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	if v.CanInterface() {
+		if t, ok := v.Interface().(encoding.TextMarshaler); ok {
+			text, err := t.MarshalText()
+			if err == nil {
+				return string(text)
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// XML encodes outputs with encoding/xml, slices wrapped in a <list> element so there is a single root
+type XML struct{}
+
+func (XML) MediaType() string {
+	return MediaTypeXML
+}
+
+// Supports reports whether encoding/xml can encode the type, which it can't for maps and interfaces, or
+// structs with such fields at any depth
+func (XML) Supports(t reflect.Type) bool {
+	return xmlSupports(t, map[reflect.Type]bool{})
+}
+
+var (
+	xmlMarshaler  = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func xmlSupports(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+
+	for _, v := range []reflect.Type{xmlMarshaler, textMarshaler} {
+		if t.Implements(v) || reflect.PointerTo(t).Implements(v) {
+			return true
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Map, reflect.Interface, reflect.Func, reflect.Chan, reflect.Complex64, reflect.Complex128,
+		reflect.UnsafePointer:
+		return false
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return xmlSupports(t.Elem(), seen)
+	case reflect.Struct:
+		for k := 0; k < t.NumField(); k++ {
+			field := t.Field(k)
+			if !field.IsExported() && !field.Anonymous || field.Tag.Get("xml") == "-" {
+				continue
+			}
+			if !xmlSupports(field.Type, seen) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (XML) Encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		return e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: "list"}})
+	}
+
+	return e.Encode(v)
+}
+
+type mediaTypeKey struct{}
+
+// negotiate is a swaggest handler wrap adding content negotiation to use case handlers: it documents
+// the media types of the output, answers 406 to an Accept none of them satisfy before the use case
+// runs, and encodes the output as the chosen one. A use case producing only media types without an
+// encoder is an error MountRoutes returns.
+func (a *API) negotiate(h http.Handler) http.Handler {
+	var handler *nethttp.Handler
+	if nethttp.IsWrapperChecker(h) || !nethttp.HandlerAs(h, &handler) {
+		return h
+	}
+
+	var hasOutput usecase2.HasOutputPort
+	if !usecase2.As(handler.UseCase(), &hasOutput) || rest.OutputHasNoContent(hasOutput.OutputPort()) {
+		return h
+	}
+	output := hasOutput.OutputPort()
+	if _, ok := output.(usecase2.OutputWithWriter); ok {
+		// Writes its own body, such as a download
+		return h
+	}
+	t := reflect.TypeOf(output)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	mediaTypes := a.Encoders.MediaTypes(t)
+	var typed usecase.MediaTyped
+	if nethttp.HandlerAs(h, &typed) {
+		var allowed []string
+		for _, v := range typed.MediaTypes() {
+			if contains(mediaTypes, v) {
+				allowed = append(allowed, v)
+			}
+		}
+		mediaTypes = allowed
+	}
+	if len(mediaTypes) == 0 {
+		// Mounting carries on so that MountRoutes can report every such use case at once
+		name := "a use case"
+		var withName usecase2.HasName
+		if usecase2.As(handler.UseCase(), &withName) && withName.Name() != "" {
+			name = withName.Name()
+		}
+		a.mountErrs = append(a.mountErrs, fmt.Errorf("%s produces %s but there is no encoder for them", name,
+			strings.Join(typed.MediaTypes(), ", ")))
+		return h
+	}
+
+	if mediaTypes[0] != MediaTypeJSON {
+		handler.SuccessContentType = mediaTypes[0]
+	}
+	handler.OpenAPIAnnotations = append(handler.OpenAPIAnnotations, func(oc openapi.OperationContext) error {
+		for _, v := range mediaTypes[1:] {
+			status := handler.SuccessStatus
+			if status == 0 {
+				status = http.StatusOK
+			}
+			oc.AddRespStructure(output, openapi.WithContentType(v), openapi.WithHTTPStatus(status))
+		}
+		return nil
+	})
+
+	return &negotiator{Handler: h, handler: handler, mediaTypes: mediaTypes, encoders: a.Encoders}
+}
+
+type negotiator struct {
+	http.Handler
+	handler    *nethttp.Handler
+	mediaTypes []string
+	encoders   *Encoders
+}
+
+// SetResponseEncoder is found by swaggest's encoder setup ahead of the wrapped handler's, so that the
+// encoder it sets up is used for JSON and for the headers, cookies and status of the other media types
+func (n *negotiator) SetResponseEncoder(e nethttp.ResponseEncoder) {
+	n.handler.SetResponseEncoder(&negotiatingEncoder{ResponseEncoder: e, encoders: n.encoders})
+}
+
+func (n *negotiator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(n.mediaTypes) > 1 {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	mediaType, ok := Negotiate(r.Header.Get("Accept"), n.mediaTypes)
+	if !ok {
+		code, body := rest.Err(fmt.Errorf("%w: the response can be %s", errNotAcceptable, strings.Join(n.mediaTypes, ", ")))
+		w.Header().Set("Content-Type", MediaTypeJSON)
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	n.Handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), mediaTypeKey{}, mediaType)))
+}
+
+type notAcceptable struct{}
+
+func (notAcceptable) Error() string   { return "not acceptable" }
+func (notAcceptable) HTTPStatus() int { return http.StatusNotAcceptable }
+
+var errNotAcceptable = notAcceptable{}
+
+// Negotiate picks the offer the Accept header prefers, offers listed earlier winning ties. Without an
+// Accept header the first offer is picked.
+func Negotiate(accept string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	type rangeQ struct {
+		mediaType   string
+		q           float64
+		specificity int
+	}
+	var ranges []rangeQ
+	for _, v := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		// Vendor types with a structured syntax suffix (application/vnd.dogs.v1+json) are taken as the suffix's type
+		if group, subtype, ok := strings.Cut(mediaType, "/"); ok {
+			if _, suffix, ok := strings.Cut(subtype, "+"); ok {
+				mediaType = group + "/" + suffix
+			}
+		}
+
+		specificity := 2
+		switch {
+		case mediaType == "*/*":
+			specificity = 0
+		case strings.HasSuffix(mediaType, "/*"):
+			specificity = 1
+		}
+		ranges = append(ranges, rangeQ{mediaType, q, specificity})
+	}
+	// The most specific range matching an offer decides its quality
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].specificity > ranges[j].specificity })
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		for _, v := range ranges {
+			group, _, _ := strings.Cut(offer, "/")
+			if v.mediaType == offer || v.mediaType == "*/*" || v.mediaType == group+"/*" {
+				if v.q > bestQ {
+					best, bestQ = offer, v.q
+				}
+				break
+			}
+		}
+	}
+
+	return best, best != ""
+}
+
+type negotiatingEncoder struct {
+	nethttp.ResponseEncoder
+	encoders *Encoders
+}
+
+func (e *negotiatingEncoder) WriteSuccessfulResponse(w http.ResponseWriter, r *http.Request, output interface{}, ht rest.HandlerTrait) {
+	mediaType, _ := r.Context().Value(mediaTypeKey{}).(string)
+	encoder, ok := e.encoders.Get(mediaType)
+	if !ok {
+		e.ResponseEncoder.WriteSuccessfulResponse(w, r, output, ht)
+		return
+	}
+
+	// swaggest writes the headers, cookies and status of the output, the JSON body it renders being
+	// dropped unless it turned out to be an error
+	capture := &capturingWriter{ResponseWriter: w}
+	e.ResponseEncoder.WriteSuccessfulResponse(capture, r, output, ht)
+	if capture.status >= http.StatusBadRequest || !capture.written {
+		capture.flush()
+		return
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := encoder.Encode(buf, output); err != nil {
+		w.Header().Del("Content-Length")
+		code, body := rest.Err(err)
+		e.WriteErrResponse(w, r, code, body)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(capture.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+type capturingWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *capturingWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written = true
+
+	return w.body.Write(data)
+}
+
+func (w *capturingWriter) flush() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/node"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(tt *testing.T) {
+	offers := []string{MediaTypeJSON, MediaTypeCSV, MediaTypeXML}
+
+	tests := []struct {
+		name   string
+		accept string
+		offers []string
+		want   string
+		wantOK bool
+	}{
+		{name: "no accept", accept: "", offers: offers, want: MediaTypeJSON, wantOK: true},
+		{name: "exact", accept: "text/csv", offers: offers, want: MediaTypeCSV, wantOK: true},
+		{name: "wildcard", accept: "*/*", offers: offers, want: MediaTypeJSON, wantOK: true},
+		{name: "type wildcard", accept: "text/*", offers: offers, want: MediaTypeCSV, wantOK: true},
+		{name: "quality", accept: "application/json;q=0.5, application/xml", offers: offers, want: MediaTypeXML, wantOK: true},
+		{name: "specific range decides", accept: "*/*;q=0.1, text/csv;q=0", offers: []string{MediaTypeCSV, MediaTypeXML}, want: MediaTypeXML, wantOK: true},
+		{name: "vendor suffix", accept: "application/vnd.dogs.v1+json", offers: offers, want: MediaTypeJSON, wantOK: true},
+		{name: "parameters", accept: "application/json; version=2", offers: offers, want: MediaTypeJSON, wantOK: true},
+		{name: "nothing acceptable", accept: "image/png", offers: offers, wantOK: false},
+		{name: "refused", accept: "text/csv;q=0", offers: offers, wantOK: false},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			got, ok := Negotiate(test.accept, test.offers)
+			t.A.Equal(test.wantOK, ok)
+			t.A.Equal(test.want, got)
+		})
+	}
+}
+
+type walkLog struct {
+	Dog     string    `json:"dog"`
+	Minutes int       `json:"minutes"`
+	At      time.Time `json:"at"`
+	Notes   []string  `json:"notes,omitempty"`
+	secret  string
+}
+
+type walkLogRequest struct {
+	Dog string `query:"dog"`
+}
+
+type walkLogSummary struct {
+	Dog   string `json:"dog" xml:"dog"`
+	Walks int    `json:"walks" xml:"walks"`
+}
+
+func TestAPI_Encoders(tt *testing.T) {
+	at := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	walks, err := usecase.New(walkLogRequest{}, &[]walkLog{}, func(ctx context.Context, input walkLogRequest, output *[]walkLog) error {
+		*output = []walkLog{
+			{Dog: input.Dog, Minutes: 30, At: at, Notes: []string{"park", "river"}, secret: "x"},
+			{Dog: input.Dog, Minutes: 15, At: at.Add(8 * time.Hour)},
+		}
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	summary, err := usecase.New(walkLogRequest{}, &walkLogSummary{}, func(ctx context.Context, input walkLogRequest, output *walkLogSummary) error {
+		output.Dog = input.Dog
+		output.Walks = 2
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	download, err := usecase.New(walkLogRequest{}, &usecase.Download{}, func(ctx context.Context, input walkLogRequest, output *usecase.Download) error {
+		output.Content = strings.NewReader("walks for " + input.Dog)
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	a := New(0, 0)
+	a.Middleware = nil
+	a.Encoders = NewEncoders(CSV{}, XML{})
+	a.Encoders.Register(EncoderFunc("application/x-text", func(w io.Writer, v any) error {
+		_, err := fmt.Fprintf(w, "%+v", v)
+		return err
+	}))
+	a.Actions = map[string]map[string]node.Handler{
+		"/walks":        {http.MethodGet: walks},
+		"/walks/export": {http.MethodGet: walks.Produces(MediaTypeCSV)},
+		"/summary":      {http.MethodGet: summary},
+		"/walks/raw":    {http.MethodGet: download.Produces("text/plain")},
+	}
+	if err := a.MountRoutes(); err != nil {
+		tt.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "json by default",
+			path:            "/walks?dog=rex",
+			wantCode:        http.StatusOK,
+			wantContentType: MediaTypeJSON,
+			wantBody:        `[{"dog":"rex","minutes":30,"at":"2026-03-01T09:30:00Z","notes":["park","river"]},{"dog":"rex","minutes":15,"at":"2026-03-01T17:30:00Z"}]` + "\n",
+		},
+		{
+			name:            "csv",
+			path:            "/walks?dog=rex",
+			accept:          "text/csv",
+			wantCode:        http.StatusOK,
+			wantContentType: MediaTypeCSV,
+			wantBody:        "dog,minutes,at,notes\nrex,30,2026-03-01T09:30:00Z,\"[\"\"park\"\",\"\"river\"\"]\"\nrex,15,2026-03-01T17:30:00Z,null\n",
+		},
+		{
+			name:            "xml",
+			path:            "/summary?dog=rex",
+			accept:          "application/xml",
+			wantCode:        http.StatusOK,
+			wantContentType: MediaTypeXML,
+			wantBody:        `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<walkLogSummary><dog>rex</dog><walks>2</walks></walkLogSummary>`,
+		},
+		{
+			name:            "registered encoder",
+			path:            "/summary?dog=rex",
+			accept:          "application/x-text",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/x-text",
+			wantBody:        "&{Dog:rex Walks:2}",
+		},
+		{
+			name:     "csv needs a slice",
+			path:     "/summary?dog=rex",
+			accept:   "text/csv",
+			wantCode: http.StatusNotAcceptable,
+		},
+		{
+			name:            "allowlist defaults to its first media type",
+			path:            "/walks/export?dog=rex",
+			wantCode:        http.StatusOK,
+			wantContentType: MediaTypeCSV,
+		},
+		{
+			name:     "allowlist refuses others",
+			path:     "/walks/export?dog=rex",
+			accept:   "application/json",
+			wantCode: http.StatusNotAcceptable,
+		},
+		{
+			name:            "downloads are not negotiated",
+			path:            "/walks/raw?dog=rex",
+			accept:          "application/xml",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/plain",
+			wantBody:        "walks for rex",
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			res := httptest.NewRecorder()
+			a.Server.ServeHTTP(res, req)
+
+			t.R.Equal(test.wantCode, res.Code, res.Body.String())
+			if test.wantContentType != "" {
+				t.A.Equal(test.wantContentType, res.Header().Get("Content-Type"))
+			}
+			if test.wantBody != "" {
+				t.A.Equal(test.wantBody, res.Body.String())
+			}
+		})
+	}
+
+	tt.Run("documented per operation", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		spec, err := json.Marshal(a.Server.OpenAPI)
+		t.R.Nil(err)
+
+		var doc struct {
+			Paths map[string]map[string]struct {
+				Responses map[string]struct {
+					Content map[string]any `json:"content"`
+				} `json:"responses"`
+			} `json:"paths"`
+		}
+		t.R.Nil(json.Unmarshal(spec, &doc))
+
+		keys := func(m map[string]any) []string {
+			var out []string
+			for k := range m {
+				out = append(out, k)
+			}
+			return out
+		}
+		t.A.ElementsMatch([]string{MediaTypeJSON, MediaTypeCSV, MediaTypeXML, "application/x-text"}, keys(doc.Paths["/walks"]["get"].Responses["200"].Content))
+		t.A.ElementsMatch([]string{MediaTypeJSON, MediaTypeXML, "application/x-text"}, keys(doc.Paths["/summary"]["get"].Responses["200"].Content))
+		t.A.ElementsMatch([]string{MediaTypeCSV}, keys(doc.Paths["/walks/export"]["get"].Responses["200"].Content))
+	})
+}
+
+func TestAPI_Encoders_mount(tt *testing.T) {
+	walks, err := usecase.New(walkLogRequest{}, &[]walkLog{}, func(ctx context.Context, input walkLogRequest, output *[]walkLog) error {
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	tt.Run("json only by default", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		a := New(0, 0)
+		a.Middleware = nil
+		a.Actions = map[string]map[string]node.Handler{"/walks": {http.MethodGet: walks}}
+		t.R.Nil(a.MountRoutes())
+
+		req := httptest.NewRequest(http.MethodGet, "/walks?dog=rex", nil)
+		req.Header.Set("Accept", MediaTypeCSV)
+		res := httptest.NewRecorder()
+		a.Server.ServeHTTP(res, req)
+		t.A.Equal(http.StatusNotAcceptable, res.Code)
+	})
+
+	tt.Run("producing a media type without an encoder", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		a := New(0, 0)
+		a.Actions = map[string]map[string]node.Handler{
+			"/walks/export": {http.MethodGet: walks.Produces(MediaTypeCSV)},
+			"/walks/yaml":   {http.MethodGet: walks.Produces("application/yaml")},
+		}
+		err := a.MountRoutes()
+		t.R.NotNil(err)
+		t.A.Contains(err.Error(), "produces text/csv but there is no encoder")
+		t.A.Contains(err.Error(), "produces application/yaml but there is no encoder")
+	})
+}
+
+type xmlTagged struct {
+	Name  string         `xml:"name"`
+	Extra map[string]int `xml:"-"`
+	cache map[string]int
+}
+
+type xmlNested struct {
+	Dog struct {
+		Tags map[string]string
+	}
+}
+
+type xmlEmbedded struct {
+	xmlTagged
+	Values []any
+}
+
+type xmlTree struct {
+	Name     string
+	Children []xmlTree
+}
+
+func TestXML_Supports(tt *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want bool
+	}{
+		{name: "struct", v: walkLogSummary{}, want: true},
+		{name: "slice of structs", v: []walkLog{}, want: true},
+		{name: "recursive", v: xmlTree{}, want: true},
+		{name: "skipped and unexported maps", v: xmlTagged{}, want: true},
+		{name: "map", v: map[string]int{}, want: false},
+		{name: "nested map", v: xmlNested{}, want: false},
+		{name: "interfaces in an embedding", v: xmlEmbedded{}, want: false},
+		{name: "slice of maps", v: []map[string]int{}, want: false},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			t.A.Equal(test.want, XML{}.Supports(reflect.TypeOf(test.v)))
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// Addresses are the addresses the listeners are bound to, Docs is nil without a docs listener
+type Addresses struct {
+	API  net.Addr
+	Docs net.Addr
+}
+
+// NewListener binds a TCP address (host:port, port 0 picking a free one) or a Unix domain socket
+// given as unix:/path/to.sock, replacing a socket file left over from a previous run.
+func NewListener(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, "unix:")
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, errors.New(path + " exists and is not a socket")
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// Ready is closed once the API is being served, Addresses being available from then on
+func (a *API) Ready() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ready == nil {
+		a.ready = make(chan struct{})
+	}
+
+	return a.ready
+}
+
+// Addresses are the bound addresses of the listeners once Ready
+func (a *API) Addresses() Addresses {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.addresses
+}
+
+// setReady records the addresses and calls OnReady before closing Ready, so that whatever the
+// callback does is visible to those waiting on the channel
+func (a *API) setReady(addresses Addresses) {
+	a.mu.Lock()
+	a.addresses = addresses
+	a.mu.Unlock()
+
+	if a.OnReady != nil {
+		a.OnReady(addresses)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ready == nil {
+		a.ready = make(chan struct{})
+	}
+	select {
+	case <-a.ready:
+	default:
+		close(a.ready)
+	}
+}
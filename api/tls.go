@@ -0,0 +1,47 @@
+package api
+
+import (
+	"crypto/tls"
+	"github.com/muverum/usecase/tlsutil"
+	"time"
+)
+
+// TLSConfig serves the listeners over TLS, verifying client certificates as well when ClientCAFile is set.
+// The files are watched so rotated certificates are used without a restart.
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ClientCAFile enables mutual TLS, the verified client identity being available to use cases
+	// through tlsutil.ClientIdentity
+	ClientCAFile string `json:"clientCaFile"`
+	// ClientAuth defaults to tls.RequireAndVerifyClientCert when ClientCAFile is set
+	ClientAuth tls.ClientAuthType `json:"-"`
+	// MinVersion defaults to TLS 1.2
+	MinVersion uint16 `json:"-"`
+	// ReloadInterval is how often the files are checked for changes, defaults to 10 seconds
+	ReloadInterval time.Duration `json:"reloadInterval"`
+}
+
+// Config loads the certificates and returns the tls.Config for a listener
+func (c *TLSConfig) Config() (*tls.Config, error) {
+	reloader, err := tlsutil.NewReloader(c.CertFile, c.KeyFile, c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.ReloadInterval > 0 {
+		reloader.Interval = c.ReloadInterval
+	}
+
+	base := &tls.Config{
+		MinVersion: c.MinVersion,
+		ClientAuth: c.ClientAuth,
+	}
+	if base.MinVersion == 0 {
+		base.MinVersion = tls.VersionTLS12
+	}
+	if c.ClientCAFile != "" && base.ClientAuth == tls.NoClientCert {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return reloader.Config(base), nil
+}
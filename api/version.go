@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"github.com/swaggest/rest/web"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Versioning mounts the nodes of the API once per version, each under a /<version> prefix and with an
+// OpenAPI document of its own. Requests without a version prefix are routed to the version selected by
+// the Accept-Version header or the Accept media type, falling back to Default.
+type Versioning struct {
+	// Versions in the order they were released, e.g. v1, v2
+	Versions []string
+	// Default is used for unversioned requests which don't select a version, defaults to the latest
+	Default string
+	// Header selecting the version of an unversioned request, defaults to Accept-Version
+	Header string
+
+	services map[string]*web.Service
+}
+
+func (v *Versioning) header() string {
+	if v.Header == "" {
+		return "Accept-Version"
+	}
+
+	return v.Header
+}
+
+func (v *Versioning) defaultVersion() string {
+	if v.Default == "" && len(v.Versions) > 0 {
+		return v.Versions[len(v.Versions)-1]
+	}
+
+	return v.Default
+}
+
+func (v *Versioning) has(version string) bool {
+	for _, k := range v.Versions {
+		if k == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Service returns the service the nodes are mounted on for version, nil before MountRoutes
+func (v *Versioning) Service(version string) *web.Service {
+	return v.services[version]
+}
+
+// Select works out which version an unversioned request asked for. The header takes precedence over
+// a version parameter (application/json; version=v2) or suffix (application/vnd.example.v2+json) in Accept.
+func (v *Versioning) Select(r *http.Request) (string, error) {
+	if h := r.Header.Get(v.header()); h != "" {
+		if !v.has(h) {
+			return "", fmt.Errorf("unsupported version %s", h)
+		}
+		return h, nil
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		if p, ok := params["version"]; ok {
+			if !v.has(p) {
+				return "", fmt.Errorf("unsupported version %s", p)
+			}
+			return p, nil
+		}
+
+		for _, k := range v.Versions {
+			if strings.HasSuffix(strings.SplitN(mediaType, "+", 2)[0], "."+k) {
+				return k, nil
+			}
+		}
+	}
+
+	return v.defaultVersion(), nil
+}
+
+// mountVersions creates a service per version carrying the nodes with their overrides for that version.
+// The version services are reached through the API server so its middleware applies to them as well.
+func (a *API) mountVersions() error {
+	v := a.Versioning
+	if len(v.Versions) == 0 {
+		return fmt.Errorf("versioning requires at least one version")
+	}
+	if !v.has(v.defaultVersion()) {
+		return fmt.Errorf("default version %s is not one of %s", v.Default, strings.Join(v.Versions, ", "))
+	}
+
+	v.services = map[string]*web.Service{}
+	for _, version := range v.Versions {
+		s := web.DefaultService(a.options...)
+		s.OpenAPI.Info.Title = a.Server.OpenAPI.Info.Title
+		s.OpenAPI.Info.Description = a.Server.OpenAPI.Info.Description
+		s.OpenAPI.Info.Version = version
+		s.Wrap(a.negotiate)
+
+		for _, n := range a.Nodes {
+			if err := n.MountVersion(s, version); err != nil {
+				return err
+			}
+		}
+
+		v.services[version] = s
+		a.Server.Handle("/"+version+"/*", versionHandler(s))
+	}
+
+	// Anything not otherwise routed is taken to be an unversioned request for one of the nodes
+	a.Server.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		version, err := v.Select(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+
+		w.Header().Add("Vary", v.header())
+		w.Header().Add("Vary", "Accept")
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + version + r.URL.Path
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = "/" + version + r.URL.RawPath
+		}
+		versionHandler(v.services[version]).ServeHTTP(w, r2)
+	})
+
+	return nil
+}
+
+// versionHandler serves a request with a version service, which routes on the full path by itself
+func versionHandler(s *web.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0])
+		standalone(s).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/muverum/usecase/audit"
+	"github.com/muverum/usecase/redact"
+	"github.com/swaggest/rest"
+	"time"
+)
+
+// Audit returns a copy of the use case which records every invocation, mutating or not, to the sink,
+// in place of any sink its node audits to
+func (i UseCase[I, O]) Audit(sink audit.Sink) UseCase[I, O] {
+	i.audit = sink
+	return i
+}
+
+// auditSink is the sink of the use case or, for a mutating request, the one in the context
+func (i UseCase[I, O]) auditSink(ctx context.Context) audit.Sink {
+	if i.audit != nil {
+		return i.audit
+	}
+
+	sink := audit.SinkFrom(ctx)
+	if rctx := chi.RouteContext(ctx); sink != nil && rctx != nil && audit.Mutating(rctx.RouteMethod) {
+		return sink
+	}
+
+	return nil
+}
+
+// record sends the audit record of an invocation, a failure to do so being logged as the outcome stands
+func (i UseCase[I, O]) record(ctx context.Context, sink audit.Sink, input I, started time.Time, err error) {
+	r := audit.Record{
+		Time:      started.UTC(),
+		Principal: audit.Principal(ctx),
+		UseCase:   i.name(),
+		RequestID: middleware.GetReqID(ctx),
+		Status:    "OK",
+		Duration:  time.Since(started),
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+		r.Route = rctx.RouteMethod + " " + rctx.RoutePattern()
+	}
+	if err != nil {
+		_, resp := rest.Err(err)
+		r.Status, r.Error = resp.StatusText, redact.Scrub(err.Error(), input)
+	}
+
+	var redactErr error
+	if r.Input, redactErr = redact.JSON(input); redactErr != nil {
+		i.log(fmt.Errorf("audit %s: redacting input: %w", r.UseCase, redactErr), input)
+	}
+
+	if err := sink.Audit(ctx, r); err != nil {
+		i.log(fmt.Errorf("audit %s: %w", r.UseCase, err), input)
+	}
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is what an invocation of an audited use case leaves behind
+type Record struct {
+	Time time.Time `json:"time"`
+	// Principal is who invoked the use case, see WithPrincipal
+	Principal string `json:"principal,omitempty"`
+	// UseCase is the title of the use case, or the type of its input when it has none
+	UseCase string `json:"useCase"`
+	// Route is the method and route pattern for invocations over HTTP, such as "POST /dogs/{id}"
+	Route     string `json:"route,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	// Input is the input with its redacted fields masked, see redact.JSON
+	Input json.RawMessage `json:"input,omitempty"`
+	// Status is the canonical status of the outcome, OK when the use case succeeded
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Sink stores audit records. Implementations must be safe for concurrent use.
+type Sink interface {
+	Audit(ctx context.Context, r Record) error
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(ctx context.Context, r Record) error
+
+func (f SinkFunc) Audit(ctx context.Context, r Record) error {
+	return f(ctx, r)
+}
+
+// Memory keeps the records it is given, for tests and for showing recent activity
+type Memory struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (m *Memory) Audit(ctx context.Context, r Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, r)
+	return nil
+}
+
+// Records returns a copy of the records so far
+func (m *Memory) Records() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record{}, m.records...)
+}
+
+// File appends each record to a file as a line of JSON
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFile opens the file at path for appending, creating it readable by its owner only if needed
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (f *File) Audit(ctx context.Context, r Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enc.Encode(r)
+}
+
+// Close closes the file, after which records can't be written
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying who is acting, which authentication middleware sets for
+// the audit records of the use cases it guards
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Principal is who is acting according to the context
+func Principal(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+type sinkKey struct{}
+
+// WithSink returns a context whose mutating use cases are audited to the sink, unless they have a
+// sink of their own
+func WithSink(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, sinkKey{}, sink)
+}
+
+// SinkFrom returns the sink set by WithSink, if any
+func SinkFrom(ctx context.Context) Sink {
+	s, _ := ctx.Value(sinkKey{}).(Sink)
+	return s
+}
+
+// Middleware audits the mutating use cases of the routes it is used on to the sink
+func Middleware(sink Sink) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithSink(r.Context(), sink)))
+		})
+	}
+}
+
+// Mutating reports whether a request method changes state, the methods audited through WithSink
+func Mutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+
+	return true
+}
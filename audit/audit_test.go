@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/metrumresearchgroup/wrapt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	path := filepath.Join(tt.TempDir(), "audit.log")
+	records := []Record{
+		{Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), UseCase: "Adopt", Status: "OK", Input: json.RawMessage(`{"dog":"rex"}`)},
+		{Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), UseCase: "Adopt", Status: "NOT_FOUND", Error: "no such dog"},
+	}
+
+	// Reopening appends rather than truncating
+	for _, r := range records {
+		f, err := NewFile(path)
+		t.R.Nil(err)
+		t.R.Nil(f.Audit(context.Background(), r))
+		t.R.Nil(f.Close())
+	}
+
+	info, err := os.Stat(path)
+	t.R.Nil(err)
+	t.A.Equal(os.FileMode(0o600), info.Mode().Perm())
+
+	file, err := os.Open(path)
+	t.R.Nil(err)
+	defer file.Close()
+
+	var got []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r Record
+		t.R.Nil(json.Unmarshal(scanner.Bytes(), &r))
+		got = append(got, r)
+	}
+	t.A.Equal(records, got)
+}
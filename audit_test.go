@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase/audit"
+	"github.com/swaggest/rest/web"
+	usecase2 "github.com/swaggest/usecase"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type adoption struct {
+	Dog      string `path:"dog"`
+	Adopter  string `json:"adopter"`
+	Password string `json:"password"`
+}
+
+type adopted struct {
+	Dog string `json:"dog"`
+}
+
+func TestUseCase_Audit(tt *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantCode   int
+		wantStatus string
+		wantError  string
+	}{
+		{name: "success", body: `{"adopter":"sam","password":"hunter2"}`, wantCode: http.StatusOK, wantStatus: "OK"},
+		{
+			name:       "failure",
+			body:       `{"adopter":"sam","password":"hunter2"}`,
+			err:        status.Wrap(errors.New("already adopted"), status.FailedPrecondition),
+			wantCode:   http.StatusPreconditionFailed,
+			wantStatus: "FAILED_PRECONDITION",
+			wantError:  "failed precondition: already adopted",
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			uc, err := New(adoption{}, &adopted{}, func(ctx context.Context, input adoption, output *adopted) error {
+				output.Dog = input.Dog
+				return test.err
+			}, nil, nil)
+			t.R.Nil(err)
+
+			sink := &audit.Memory{}
+			s := web.DefaultService()
+			s.Use(middleware.RequestID, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r.WithContext(audit.WithPrincipal(r.Context(), "sam@example.com")))
+				})
+			})
+			s.Method(http.MethodPost, "/dogs/{dog}/adoptions", uc.Audit(sink).Handler())
+
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/dogs/rex/adoptions", strings.NewReader(test.body)))
+			t.R.Equal(test.wantCode, res.Code, res.Body.String())
+
+			records := sink.Records()
+			t.R.Len(records, 1)
+			r := records[0]
+			t.A.Equal("sam@example.com", r.Principal)
+			t.A.Equal("usecase.adoption", r.UseCase)
+			t.A.Equal("POST /dogs/{dog}/adoptions", r.Route)
+			t.A.NotEmpty(r.RequestID)
+			t.A.JSONEq(`{"Dog":"rex","adopter":"sam","password":"[REDACTED]"}`, string(r.Input))
+			t.A.Equal(test.wantStatus, r.Status)
+			t.A.Equal(test.wantError, r.Error)
+			t.A.False(r.Time.IsZero())
+			t.A.Positive(r.Duration)
+		})
+	}
+
+	tt.Run("outside HTTP", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		uc, err := New(adoption{}, &adopted{}, func(ctx context.Context, input adoption, output *adopted) error {
+			return nil
+		}, func(u *usecase2.IOInteractor) {
+			u.SetTitle("Adopt a dog")
+		}, nil)
+		t.R.Nil(err)
+
+		sink := &audit.Memory{}
+		_, err = uc.Audit(sink).Execute(audit.WithPrincipal(context.Background(), "queue"), adoption{Dog: "rex"})
+		t.R.Nil(err)
+
+		records := sink.Records()
+		t.R.Len(records, 1)
+		t.A.Equal("Adopt a dog", records[0].UseCase)
+		t.A.Equal("queue", records[0].Principal)
+		t.A.Empty(records[0].Route)
+	})
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/muverum/usecase"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/usecase/status"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Exit codes returned by App.Run, grouped by the class of error the use case produced
+const (
+	ExitOK          = 0
+	ExitError       = 1
+	ExitUsage       = 2
+	ExitNotFound    = 3
+	ExitPermission  = 4
+	ExitConflict    = 5
+	ExitUnavailable = 6
+)
+
+// Command is a use case exposed as a subcommand of an App
+type Command struct {
+	Name        string
+	Description string
+	run         func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// New builds a subcommand for the use case. Flags are derived from the input struct, and a JSON document
+// may be supplied instead (or as a base the flags override) with -input, using - for stdin.
+func New[I any, O any](name string, uc usecase.UseCase[I, O], options ...func(c *Command)) *Command {
+	c := &Command{
+		Name: name,
+	}
+
+	var zero I
+	fields := inputFields(zero)
+
+	c.run = func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+
+		inputPath := fs.String("input", "", "JSON `file` providing the input, - reads stdin")
+		format := fs.String("output", "json", "output `format`, json or table")
+
+		values := map[string]any{}
+		for _, v := range fields {
+			fs.Var(&fieldValue{field: v, values: values}, v.flag, v.usage())
+		}
+
+		fs.Usage = func() {
+			_, _ = fmt.Fprintf(stderr, "Usage of %s:\n", name)
+			if c.Description != "" {
+				_, _ = fmt.Fprintf(stderr, "  %s\n", c.Description)
+			}
+			fs.PrintDefaults()
+		}
+
+		if err := fs.Parse(args); err != nil {
+			return status.Wrap(err, status.InvalidArgument)
+		}
+
+		document := map[string]any{}
+		if *inputPath != "" {
+			if err := readInput(*inputPath, stdin, &document); err != nil {
+				return status.Wrap(err, status.InvalidArgument)
+			}
+		}
+
+		for k, v := range values {
+			document[k] = v
+		}
+
+		data, err := json.Marshal(document)
+		if err != nil {
+			return err
+		}
+
+		in, err := uc.DecodeJSON(data)
+		if err != nil {
+			return err
+		}
+
+		out, err := uc.Execute(ctx, in)
+		if err != nil {
+			return err
+		}
+
+		switch *format {
+		case "table":
+			return writeTable(stdout, out)
+		default:
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		}
+	}
+
+	for _, v := range options {
+		v(c)
+	}
+
+	return c
+}
+
+func readInput(path string, stdin io.Reader, v any) error {
+	var r io.Reader = stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return json.NewDecoder(r).Decode(v)
+}
+
+// App dispatches the first argument to the subcommand of the same name
+type App struct {
+	Name     string
+	Commands []*Command
+	Stdin    io.Reader
+	Stdout   io.Writer
+	Stderr   io.Writer
+}
+
+func NewApp(name string, commands ...*Command) *App {
+	return &App{
+		Name:     name,
+		Commands: commands,
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+	}
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit code
+func (a *App) Run(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage()
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOK
+	}
+
+	for _, v := range a.Commands {
+		if v.Name != args[0] {
+			continue
+		}
+
+		err := v.run(ctx, args[1:], a.Stdin, a.Stdout, a.Stderr)
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		if err != nil {
+			a.printError(err)
+		}
+
+		return ExitCode(err)
+	}
+
+	_, _ = fmt.Fprintf(a.Stderr, "unknown command %q\n", args[0])
+	a.usage()
+	return ExitUsage
+}
+
+func (a *App) usage() {
+	_, _ = fmt.Fprintf(a.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", a.Name)
+
+	commands := append([]*Command{}, a.Commands...)
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	for _, v := range commands {
+		_, _ = fmt.Fprintf(a.Stderr, "  %-20s %s\n", v.Name, v.Description)
+	}
+}
+
+func (a *App) printError(err error) {
+	_, er := rest.Err(err)
+	_, _ = fmt.Fprintf(a.Stderr, "error: %s\n", er.Error())
+
+	for _, k := range sortedKeys(er.Context) {
+		_, _ = fmt.Fprintf(a.Stderr, "  %s: %v\n", k, er.Context[k])
+	}
+}
+
+// ExitCode classifies an error returned by a use case the same way the HTTP layer would,
+// collapsing the resulting status into a small set of exit codes.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	code, _ := rest.Err(err)
+	switch code {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return ExitUsage
+	case http.StatusNotFound:
+		return ExitNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ExitPermission
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return ExitConflict
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return ExitUnavailable
+	}
+
+	return ExitError
+}
+
+// Description sets the text shown next to the command in usage output
+func Description(text string) func(c *Command) {
+	return func(c *Command) {
+		c.Description = text
+	}
+}
+
+func joinUsage(parts ...string) string {
+	out := make([]string, 0, len(parts))
+	for _, v := range parts {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase"
+	"github.com/swaggest/usecase/status"
+	"strings"
+	"testing"
+)
+
+type greetRequest struct {
+	Name  string   `json:"name" required:"true" minLength:"2" description:"Who to greet"`
+	Times int      `path:"times"`
+	Loud  bool     `query:"loud"`
+	Tags  []string `json:"tags"`
+}
+
+type greeting struct {
+	Message string `json:"message"`
+	Tags    int    `json:"tags"`
+}
+
+func testApp(tt *testing.T) (*App, *bytes.Buffer, *bytes.Buffer) {
+	greet, err := usecase.New(greetRequest{}, &[]greeting{}, func(ctx context.Context, input greetRequest, output *[]greeting) error {
+		if input.Name == "nobody" {
+			return status.Wrap(errors.New("no such person"), status.NotFound)
+		}
+		for i := 0; i < input.Times; i++ {
+			message := "hello " + input.Name
+			if input.Loud {
+				message = strings.ToUpper(message)
+			}
+			*output = append(*output, greeting{Message: message, Tags: len(input.Tags)})
+		}
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	app := NewApp("greeter", New("greet", greet, Description("Greets someone")))
+	app.Stdout = stdout
+	app.Stderr = stderr
+
+	return app, stdout, stderr
+}
+
+func TestApp_Run(tt *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		stdin         string
+		wantCode      int
+		assertionFunc func(t *wrapt.T, stdout, stderr string)
+	}{
+		{
+			name:     "flags from json path and query tags",
+			args:     []string{"greet", "-name", "bob", "-times", "2", "-loud", "-tags", "a,b", "-tags", "c"},
+			wantCode: ExitOK,
+			assertionFunc: func(t *wrapt.T, stdout, stderr string) {
+				t.A.JSONEq(`[{"message":"HELLO BOB","tags":3},{"message":"HELLO BOB","tags":3}]`, stdout)
+			},
+		},
+		{
+			name:     "stdin input overridden by flags",
+			args:     []string{"greet", "-input", "-", "-times", "1", "-output", "table"},
+			stdin:    `{"name":"alice","Times":5}`,
+			wantCode: ExitOK,
+			assertionFunc: func(t *wrapt.T, stdout, stderr string) {
+				t.A.Equal("MESSAGE      TAGS\nhello alice  0\n", stdout)
+			},
+		},
+		{
+			name:     "schema validation is a usage error",
+			args:     []string{"greet", "-name", "x"},
+			wantCode: ExitUsage,
+			assertionFunc: func(t *wrapt.T, stdout, stderr string) {
+				t.A.Contains(stderr, "validation failed")
+				t.A.Contains(stderr, "body:")
+			},
+		},
+		{
+			name:     "missing required field",
+			args:     []string{"greet", "-times", "1"},
+			wantCode: ExitUsage,
+		},
+		{
+			name:     "use case error classes",
+			args:     []string{"greet", "-name", "nobody"},
+			wantCode: ExitNotFound,
+			assertionFunc: func(t *wrapt.T, stdout, stderr string) {
+				t.A.Contains(stderr, "no such person")
+			},
+		},
+		{
+			name:     "flag usage shows tags",
+			args:     []string{"greet", "-h"},
+			wantCode: ExitOK,
+			assertionFunc: func(t *wrapt.T, stdout, stderr string) {
+				t.A.Contains(stderr, "Who to greet (required, min length 2)")
+			},
+		},
+		{
+			name:     "unknown command",
+			args:     []string{"wave"},
+			wantCode: ExitUsage,
+			assertionFunc: func(t *wrapt.T, stdout, stderr string) {
+				t.A.Contains(stderr, "greet")
+				t.A.Contains(stderr, "Greets someone")
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			app, stdout, stderr := testApp(tt)
+			app.Stdin = strings.NewReader(test.stdin)
+
+			t.A.Equal(test.wantCode, app.Run(context.Background(), test.args))
+
+			if test.assertionFunc != nil {
+				test.assertionFunc(t, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
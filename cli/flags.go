@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// field describes a flag derived from a field of the use case input struct
+type field struct {
+	flag        string
+	key         string
+	typ         reflect.Type
+	description string
+	required    bool
+	minLength   string
+}
+
+func (f field) usage() string {
+	var constraints []string
+	if f.required {
+		constraints = append(constraints, "required")
+	}
+	if f.minLength != "" {
+		constraints = append(constraints, "min length "+f.minLength)
+	}
+
+	var suffix string
+	if len(constraints) > 0 {
+		suffix = "(" + strings.Join(constraints, ", ") + ")"
+	}
+
+	return joinUsage(f.description, suffix)
+}
+
+// inputFields walks the input struct (including embedded structs) and produces a flag for every
+// field addressable through its json, path or query tag.
+func inputFields(input any) []field {
+	t := reflect.TypeOf(input)
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("json") == "" {
+			fields = append(fields, inputFields(reflect.New(sf.Type).Elem().Interface())...)
+			continue
+		}
+
+		if !sf.IsExported() || !supported(sf.Type) {
+			continue
+		}
+
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+
+		name := jsonName
+		for _, v := range []string{"path", "query"} {
+			if name == "" {
+				name = sf.Tag.Get(v)
+			}
+		}
+		if name == "" {
+			continue
+		}
+
+		// Fields without a json tag are matched by encoding/json through their Go name
+		key := jsonName
+		if key == "" {
+			key = sf.Name
+		}
+
+		fields = append(fields, field{
+			flag:        name,
+			key:         key,
+			typ:         sf.Type,
+			description: sf.Tag.Get("description"),
+			required:    sf.Tag.Get("required") == "true",
+			minLength:   sf.Tag.Get("minLength"),
+		})
+	}
+
+	return fields
+}
+
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && supported(t.Elem())
+	case reflect.Ptr:
+		return supported(t.Elem())
+	}
+
+	return false
+}
+
+// fieldValue is the flag.Value storing parsed flags into the document that becomes the input
+type fieldValue struct {
+	field  field
+	values map[string]any
+}
+
+func (v *fieldValue) String() string {
+	return ""
+}
+
+func (v *fieldValue) IsBoolFlag() bool {
+	return base(v.field.typ).Kind() == reflect.Bool
+}
+
+func (v *fieldValue) Set(s string) error {
+	t := v.field.typ
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() == reflect.Slice {
+		current, _ := v.values[v.field.key].([]any)
+		for _, part := range strings.Split(s, ",") {
+			parsed, err := parse(t.Elem(), part)
+			if err != nil {
+				return err
+			}
+			current = append(current, parsed)
+		}
+		v.values[v.field.key] = current
+		return nil
+	}
+
+	parsed, err := parse(t, s)
+	if err != nil {
+		return err
+	}
+	v.values[v.field.key] = parsed
+
+	return nil
+}
+
+func base(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+func parse(t reflect.Type, s string) (any, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, t.Bits())
+	}
+
+	return nil, fmt.Errorf("unsupported flag type %s", t)
+}
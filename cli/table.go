@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// writeTable renders the output as it would be marshaled to JSON: objects become key/value rows,
+// arrays of objects become one row per element with a column per key, anything else is printed as is.
+func writeTable(w io.Writer, output any) error {
+	data, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+
+	var v any
+	if err = json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	switch value := v.(type) {
+	case map[string]any:
+		for _, k := range sortedKeys(value) {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(k), cell(value[k]))
+		}
+	case []any:
+		columns := map[string]bool{}
+		for _, row := range value {
+			if m, ok := row.(map[string]any); ok {
+				for k := range m {
+					columns[k] = true
+				}
+			}
+		}
+
+		if len(columns) == 0 {
+			for _, row := range value {
+				_, _ = fmt.Fprintln(tw, cell(row))
+			}
+			break
+		}
+
+		header := sortedKeys(columns)
+		upper := make([]string, len(header))
+		for k, h := range header {
+			upper[k] = strings.ToUpper(h)
+		}
+		_, _ = fmt.Fprintln(tw, strings.Join(upper, "\t"))
+
+		for _, row := range value {
+			m, _ := row.(map[string]any)
+			cells := make([]string, len(header))
+			for k, h := range header {
+				cells[k] = cell(m[h])
+			}
+			_, _ = fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	default:
+		_, _ = fmt.Fprintln(tw, cell(value))
+	}
+
+	return tw.Flush()
+}
+
+func cell(v any) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case map[string]any, []any:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+
+	return fmt.Sprint(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,11 @@
+// Command usecasevet runs the use case analyzer, on its own or through go vet -vettool=$(which usecasevet)
+package main
+
+import (
+	"github.com/muverum/usecase/vet"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(vet.Analyzer)
+}
@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/swaggest/rest"
+	"net/http"
+	"time"
+)
+
+// DeprecatedCalls counts the calls made to deprecated routes keyed by "METHOD pattern", it is published
+// with expvar so it shows up on /debug/vars
+var DeprecatedCalls = expvar.NewMap("usecase_deprecated_calls")
+
+// Deprecation marks a use case or a whole node as retired
+type Deprecation struct {
+	// Since is when the route was deprecated, the Deprecation header is sent as "true" when unset
+	Since time.Time
+	// Sunset is when the route stops being served, optional
+	Sunset time.Time
+	// Link points at the replacement, sent as a successor-version link
+	Link string
+	// GoneAfterSunset answers 410 Gone once Sunset has passed instead of serving the request
+	GoneAfterSunset bool
+}
+
+// Deprecate returns a copy of the use case marked as deprecated both in its responses and in OpenAPI
+func (i UseCase[I, O]) Deprecate(d Deprecation) UseCase[I, O] {
+	i.deprecation = &d
+	return i
+}
+
+// Deprecation is nil unless the use case was deprecated
+func (i UseCase[I, O]) Deprecation() *Deprecation {
+	return i.deprecation
+}
+
+// Gone reports whether the sunset has passed and the route should answer 410
+func (d Deprecation) Gone(now time.Time) bool {
+	return d.GoneAfterSunset && !d.Sunset.IsZero() && !now.Before(d.Sunset)
+}
+
+// Middleware adds the Deprecation, Sunset and Link headers to every response and counts the call
+func (d Deprecation) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.Since.IsZero() {
+			w.Header().Set("Deprecation", "true")
+		} else {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+		}
+		if !d.Sunset.IsZero() {
+			w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Link != "" {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, d.Link))
+		}
+
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		DeprecatedCalls.Add(r.Method+" "+route, 1)
+
+		if d.Gone(time.Now()) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusGone)
+			_ = json.NewEncoder(w).Encode(rest.ErrResponse{
+				StatusText: http.StatusText(http.StatusGone),
+				ErrorText:  fmt.Sprintf("this endpoint was retired on %s", d.Sunset.UTC().Format(time.DateOnly)),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/swaggest/rest/web"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUseCase_Deprecate(tt *testing.T) {
+	type Input struct {
+		Name string `query:"name"`
+	}
+
+	type Output struct {
+		Greeting string `json:"greeting"`
+	}
+
+	uc, err := New(Input{}, &Output{}, func(ctx context.Context, input Input, output *Output) error {
+		output.Greeting = "hello " + input.Name
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		deprecation   Deprecation
+		assertionFunc func(t *wrapt.T, res *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "headers are added while still served",
+			deprecation: Deprecation{Since: since, Sunset: time.Now().Add(time.Hour), Link: "/v2/greet", GoneAfterSunset: true},
+			assertionFunc: func(t *wrapt.T, res *httptest.ResponseRecorder) {
+				t.A.Equal(http.StatusOK, res.Code)
+				t.A.Equal("@1704067200", res.Header().Get("Deprecation"))
+				t.A.NotEmpty(res.Header().Get("Sunset"))
+				t.A.Equal(`</v2/greet>; rel="successor-version"`, res.Header().Get("Link"))
+				t.A.Contains(res.Body.String(), "hello bob")
+			},
+		},
+		{
+			name:        "past the sunset the route is gone",
+			deprecation: Deprecation{Sunset: since, GoneAfterSunset: true},
+			assertionFunc: func(t *wrapt.T, res *httptest.ResponseRecorder) {
+				t.A.Equal(http.StatusGone, res.Code)
+				t.A.Equal("true", res.Header().Get("Deprecation"))
+				t.A.Contains(res.Body.String(), "retired on 2024-01-01")
+			},
+		},
+		{
+			name:        "past the sunset the route is still served unless gone is requested",
+			deprecation: Deprecation{Sunset: since},
+			assertionFunc: func(t *wrapt.T, res *httptest.ResponseRecorder) {
+				t.A.Equal(http.StatusOK, res.Code)
+				t.A.Equal("Mon, 01 Jan 2024 00:00:00 GMT", res.Header().Get("Sunset"))
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			s := web.DefaultService()
+			s.Method(http.MethodGet, "/greet", uc.Deprecate(test.deprecation).Handler())
+
+			before := "0"
+			if v := DeprecatedCalls.Get("GET /greet"); v != nil {
+				before = v.String()
+			}
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/greet?name=bob", nil))
+
+			test.assertionFunc(t, res)
+			t.R.NotNil(DeprecatedCalls.Get("GET /greet"))
+			t.A.NotEqual(before, DeprecatedCalls.Get("GET /greet").String())
+
+			spec, err := json.Marshal(s.OpenAPI)
+			t.R.Nil(err)
+			t.A.Contains(string(spec), `"deprecated":true`)
+		})
+	}
+
+	tt.Run("the original use case is untouched", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+		t.A.Nil(uc.Deprecation())
+		t.A.NotNil(uc.Deprecate(Deprecation{}).Deprecation())
+	})
+}
@@ -10,7 +10,7 @@ import (
 
 type DogWalkRequest struct {
 	_     struct{} `title:"DogWalkRequest"`
-	Place string   `json:"place" requird:"true" path:"place"`
+	Place string   `json:"place" required:"true" path:"place"`
 	Times int      `json:"times" path:"times" description:"The number of times to walk said dog"`
 }
 
@@ -0,0 +1,425 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/swaggest/openapi-go"
+	"github.com/swaggest/openapi-go/openapi3"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/rest/nethttp"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MediaTypeOctetStream is the content type of downloads which don't give one
+const MediaTypeOctetStream = "application/octet-stream"
+
+// Download is the output of a use case returning binary content rather than JSON, either as the output
+// itself or embedded in it. Over HTTP the content is streamed as the response body, with range requests
+// served when it can seek, and outside HTTP it is left for the caller to read.
+type Download struct {
+	// Content is closed once it has been sent when it is an io.Closer
+	Content io.Reader `json:"-"`
+	// ContentType defaults to the first media type the use case Produces, or application/octet-stream
+	ContentType string `json:"-"`
+	// Filename when set is given in Content-Disposition, as an attachment unless Inline
+	Filename string `json:"-"`
+	Inline   bool   `json:"-"`
+	// Size is sent as Content-Length for content which can't seek, unknown when zero
+	Size int64 `json:"-"`
+	// ModTime when set is sent as Last-Modified and used for conditional requests
+	ModTime time.Time `json:"-"`
+
+	w io.Writer
+}
+
+// SetWriter is called by swaggest with the response writer, telling it not to render the output as JSON
+func (d *Download) SetWriter(w io.Writer) {
+	d.w = w
+}
+
+func (d *Download) download() *Download {
+	return d
+}
+
+// SetupContentUnit documents the content as a binary string rather than a JSON object
+func (d *Download) SetupContentUnit(cu *openapi.ContentUnit) {
+	cu.Structure = downloadHeaders{}
+	cu.Format = "binary"
+}
+
+// downloadHeaders documents the headers a download is served with
+type downloadHeaders struct {
+	ContentDisposition string `header:"Content-Disposition" description:"attachment or inline, with the filename when there is one"`
+	AcceptRanges       string `header:"Accept-Ranges" description:"bytes when ranges of the content can be requested"`
+	LastModified       string `header:"Last-Modified"`
+}
+
+type downloadable interface {
+	download() *Download
+}
+
+type requestKey struct{}
+
+// serve writes the content to the response writer swaggest set, if any, leaving it to the caller otherwise
+func (d *Download) serve(ctx context.Context, contentType string) error {
+	w, ok := d.w.(http.ResponseWriter)
+	r, _ := ctx.Value(requestKey{}).(*http.Request)
+	if !ok || r == nil {
+		return nil
+	}
+
+	if closer, ok := d.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if d.Content == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	if d.ContentType != "" {
+		contentType = d.ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	if d.Filename != "" {
+		disposition := "attachment"
+		if d.Inline {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": d.Filename}))
+	}
+
+	if rs, ok := d.Content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, d.Filename, d.ModTime, rs)
+		return nil
+	}
+
+	if !d.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", d.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if d.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(d.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	// The status has been sent so a failure part way can only cut the response short
+	_, _ = io.Copy(w, d.Content)
+	return nil
+}
+
+// contentType is the documented and default content type of a download
+func (i UseCase[I, O]) contentType() string {
+	if len(i.produces) > 0 {
+		return i.produces[0]
+	}
+
+	return MediaTypeOctetStream
+}
+
+func (i UseCase[I, O]) downloads() bool {
+	_, ok := any(i.output).(downloadable)
+	return ok
+}
+
+// AnnotateDownload documents the ranges of a download
+func AnnotateDownload(contentType string, output any) func(oc openapi.OperationContext) error {
+	return func(oc openapi.OperationContext) error {
+		oc.AddRespStructure(output, openapi.WithContentType(contentType), openapi.WithHTTPStatus(http.StatusPartialContent))
+
+		o3, ok := oc.(openapi3.OperationExposer)
+		if !ok {
+			return nil
+		}
+
+		str := openapi3.SchemaTypeString
+		op := o3.Operation()
+		op.Parameters = append(op.Parameters, openapi3.ParameterOrRef{Parameter: &openapi3.Parameter{
+			Name:        "Range",
+			In:          openapi3.ParameterInHeader,
+			Description: ptr("byte ranges of the content, such as bytes=0-1023"),
+			Schema:      &openapi3.SchemaOrRef{Schema: &openapi3.Schema{Type: &str}},
+		}})
+
+		return nil
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// UploadLimits bound the multipart requests of a use case with file fields
+type UploadLimits struct {
+	// MaxRequestSize rejects larger requests with 413, defaults to 32MB
+	MaxRequestSize int64
+	// MaxMemory is how much of the files is held in memory, the rest being streamed to temporary files
+	// which are removed once the request is done. Defaults to 10MB.
+	MaxMemory int64
+}
+
+// Uploads returns a copy of the use case with the limits applied to its multipart requests. Each file
+// field of the input can be limited further with its maxSize (10MB, 512KB) and accept (image/png,image/*)
+// tags, a file breaking them being answered with 422 like any other invalid field.
+func (i UseCase[I, O]) Uploads(limits UploadLimits) UseCase[I, O] {
+	i.uploads = &limits
+	return i
+}
+
+func (l *UploadLimits) middleware(next http.Handler) http.Handler {
+	maxRequest, maxMemory := int64(32<<20), int64(10<<20)
+	if l != nil && l.MaxRequestSize > 0 {
+		maxRequest = l.MaxRequestSize
+	}
+	if l != nil && l.MaxMemory > 0 {
+		maxMemory = l.MaxMemory
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > maxRequest {
+			tooLarge(w, maxRequest)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequest)
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				tooLarge(w, maxRequest)
+				return
+			}
+			// Left for swaggest's decoder to report
+		}
+		if r.MultipartForm != nil {
+			defer r.MultipartForm.RemoveAll()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	_ = json.NewEncoder(w).Encode(rest.ErrResponse{
+		StatusText: http.StatusText(http.StatusRequestEntityTooLarge),
+		ErrorText:  fmt.Sprintf("the request is larger than %s", formatSize(limit)),
+	})
+}
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+type fileField struct {
+	index   []int
+	name    string
+	maxSize int64
+	accept  []string
+}
+
+type fileFieldsOf struct {
+	fields []fileField
+	err    error
+}
+
+var fileFieldCache sync.Map
+
+// fileFields finds the multipart.FileHeader fields of an input type, with their limits, failing when a
+// limit can't be parsed
+func fileFields(t reflect.Type) ([]fileField, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if v, ok := fileFieldCache.Load(t); ok {
+		return v.(fileFieldsOf).fields, v.(fileFieldsOf).err
+	}
+
+	var fields []fileField
+	var errs []error
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+
+		for k := 0; k < t.NumField(); k++ {
+			sf := t.Field(k)
+			at := append(append([]int{}, index...), k)
+			if sf.Anonymous {
+				walk(sf.Type, at)
+				continue
+			}
+			if sf.Type != fileHeaderType && sf.Type != fileHeadersType {
+				continue
+			}
+
+			name := sf.Tag.Get("formData")
+			if name == "" {
+				name = sf.Name
+			}
+			f := fileField{index: at, name: name}
+			if v := sf.Tag.Get("maxSize"); v != "" {
+				size, err := ParseSize(v)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s.%s maxSize: %w", t, sf.Name, err))
+				}
+				f.maxSize = size
+			}
+			for _, v := range strings.Split(sf.Tag.Get("accept"), ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					f.accept = append(f.accept, v)
+				}
+			}
+			fields = append(fields, f)
+		}
+	}
+	walk(t, nil)
+
+	err := errors.Join(errs...)
+	fileFieldCache.Store(t, fileFieldsOf{fields: fields, err: err})
+	return fields, err
+}
+
+// hasFiles reports whether the input has file fields, New having rejected those whose limits can't be parsed
+func (i UseCase[I, O]) hasFiles() bool {
+	fields, _ := fileFields(reflect.TypeOf(i.input))
+	return len(fields) > 0
+}
+
+// checkFiles reports the uploaded files breaking the limits of their fields
+func checkFiles(input any) error {
+	v := reflect.Indirect(reflect.ValueOf(input))
+	if !v.IsValid() {
+		return nil
+	}
+
+	files, err := fileFields(v.Type())
+	if err != nil {
+		return err
+	}
+
+	fields := rest.ValidationErrors{}
+	for _, f := range files {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+
+		var headers []*multipart.FileHeader
+		switch h := fv.Interface().(type) {
+		case *multipart.FileHeader:
+			if h != nil {
+				headers = append(headers, h)
+			}
+		case []*multipart.FileHeader:
+			headers = h
+		}
+
+		key := "formData:" + f.name
+		for _, h := range headers {
+			if f.maxSize > 0 && h.Size > f.maxSize {
+				fields[key] = append(fields[key], fmt.Sprintf("%s is larger than %s", h.Filename, formatSize(f.maxSize)))
+			}
+			if len(f.accept) > 0 && !acceptable(h.Header.Get("Content-Type"), f.accept) {
+				fields[key] = append(fields[key], fmt.Sprintf("%s is not one of %s", h.Filename, strings.Join(f.accept, ", ")))
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return fields
+}
+
+func acceptable(contentType string, accept []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range accept {
+		if matched, _ := path.Match(v, mediaType); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// ParseSize reads a size such as 512KB, 10MB or 1024 (bytes)
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return n * multiplier, nil
+}
+
+func formatSize(n int64) string {
+	for _, u := range sizeUnits {
+		if n >= u.size && n%u.size == 0 {
+			return fmt.Sprintf("%d%s", n/u.size, u.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%dB", n)
+}
+
+// requestMiddleware makes the request available to downloads, which serve ranges, to pages, which link
+// from its URL, and to list queries, which are parsed from its query
+func requestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestKey{}, r)))
+	})
+}
+
+func (i UseCase[I, O]) fileHandlerOptions() []func(h *nethttp.Handler) {
+	if !i.downloads() {
+		return nil
+	}
+
+	return []func(h *nethttp.Handler){
+		nethttp.SuccessfulResponseContentType(i.contentType()),
+		nethttp.AnnotateOpenAPIOperation(AnnotateDownload(i.contentType(), i.output)),
+	}
+}
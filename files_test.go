@@ -0,0 +1,325 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/swaggest/rest/web"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type photoUpload struct {
+	Dog    string                  `formData:"dog" required:"true"`
+	Photo  *multipart.FileHeader   `formData:"photo" maxSize:"1KB" accept:"image/png,image/jpeg"`
+	Extras []*multipart.FileHeader `formData:"extras" accept:"image/*"`
+}
+
+type photoUploaded struct {
+	Dog   string `json:"dog"`
+	Bytes int64  `json:"bytes"`
+}
+
+type upload struct {
+	field, filename, contentType string
+	size                         int
+}
+
+func multipartBody(tt *testing.T, dog string, files ...upload) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	if err := mw.WriteField("dog", dog); err != nil {
+		tt.Fatal(err)
+	}
+	for _, f := range files {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+f.field+`"; filename="`+f.filename+`"`)
+		h.Set("Content-Type", f.contentType)
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		_, _ = pw.Write(bytes.Repeat([]byte("x"), f.size))
+	}
+	if err := mw.Close(); err != nil {
+		tt.Fatal(err)
+	}
+
+	return body, mw.FormDataContentType()
+}
+
+func TestUseCase_Uploads(tt *testing.T) {
+	tests := []struct {
+		name        string
+		files       []upload
+		wantCode    int
+		wantContext map[string][]string
+		wantBytes   int64
+	}{
+		{
+			name:      "within limits",
+			files:     []upload{{"photo", "rex.png", "image/png", 600}, {"extras", "a.jpg", "image/jpeg", 10}},
+			wantCode:  http.StatusOK,
+			wantBytes: 600,
+		},
+		{
+			name:        "too large",
+			files:       []upload{{"photo", "rex.png", "image/png", 2000}},
+			wantCode:    http.StatusUnprocessableEntity,
+			wantContext: map[string][]string{"formData:photo": {"rex.png is larger than 1KB"}},
+		},
+		{
+			name:     "wrong content type",
+			files:    []upload{{"photo", "rex.gif", "image/gif", 10}, {"extras", "notes.txt", "text/plain", 10}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantContext: map[string][]string{
+				"formData:photo":  {"rex.gif is not one of image/png, image/jpeg"},
+				"formData:extras": {"notes.txt is not one of image/*"},
+			},
+		},
+		{
+			name:     "request too large",
+			files:    []upload{{"extras", "big.png", "image/png", 5000}},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			uc, err := New(photoUpload{}, &photoUploaded{}, func(ctx context.Context, input photoUpload, output *photoUploaded) error {
+				output.Dog = input.Dog
+				if input.Photo != nil {
+					output.Bytes = input.Photo.Size
+				}
+				return nil
+			}, nil, nil)
+			t.R.Nil(err)
+
+			s := web.DefaultService()
+			s.Method(http.MethodPost, "/photos", uc.Uploads(UploadLimits{MaxRequestSize: 4096, MaxMemory: 512}).Handler())
+
+			body, contentType := multipartBody(tt, "rex", test.files...)
+			req := httptest.NewRequest(http.MethodPost, "/photos", body)
+			req.Header.Set("Content-Type", contentType)
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+
+			t.R.Equal(test.wantCode, res.Code, res.Body.String())
+			if test.wantCode == http.StatusOK {
+				var out photoUploaded
+				t.R.Nil(json.Unmarshal(res.Body.Bytes(), &out))
+				t.A.Equal(photoUploaded{Dog: "rex", Bytes: test.wantBytes}, out)
+			}
+			if test.wantContext != nil {
+				var out struct {
+					Context map[string][]string `json:"context"`
+				}
+				t.R.Nil(json.Unmarshal(res.Body.Bytes(), &out))
+				t.A.Equal(test.wantContext, out.Context)
+			}
+		})
+	}
+}
+
+type reportRequest struct {
+	Dog string `path:"dog"`
+}
+
+type report struct {
+	Download
+}
+
+func TestUseCase_Download(tt *testing.T) {
+	modified := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	content := "walks,minutes\nmon,30\ntue,45\n"
+
+	seekable, err := New(reportRequest{}, &report{}, func(ctx context.Context, input reportRequest, output *report) error {
+		output.Content = strings.NewReader(content)
+		output.Filename = input.Dog + ".csv"
+		output.ModTime = modified
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	streamed, err := New(reportRequest{}, &Download{}, func(ctx context.Context, input reportRequest, output *Download) error {
+		output.Content = io.NopCloser(strings.NewReader(content))
+		output.ContentType = "text/plain"
+		output.Filename = input.Dog + ".txt"
+		output.Inline = true
+		output.Size = int64(len(content))
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	s := web.DefaultService()
+	s.Method(http.MethodGet, "/reports/{dog}", seekable.Produces("text/csv").Handler())
+	s.Method(http.MethodGet, "/streams/{dog}", streamed.Handler())
+
+	tests := []struct {
+		name       string
+		path       string
+		header     map[string]string
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name:     "whole content",
+			path:     "/reports/rex",
+			wantCode: http.StatusOK,
+			wantBody: content,
+			wantHeader: map[string]string{
+				"Content-Type":        "text/csv",
+				"Content-Disposition": `attachment; filename=rex.csv`,
+				"Accept-Ranges":       "bytes",
+				"Last-Modified":       modified.Format(http.TimeFormat),
+			},
+		},
+		{
+			name:       "range",
+			path:       "/reports/rex",
+			header:     map[string]string{"Range": "bytes=14-19"},
+			wantCode:   http.StatusPartialContent,
+			wantBody:   "mon,30",
+			wantHeader: map[string]string{"Content-Range": "bytes 14-19/28"},
+		},
+		{
+			name:     "not modified",
+			path:     "/reports/rex",
+			header:   map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "streamed",
+			path:     "/streams/rex",
+			wantCode: http.StatusOK,
+			wantBody: content,
+			wantHeader: map[string]string{
+				"Content-Type":        "text/plain",
+				"Content-Disposition": `inline; filename=rex.txt`,
+				"Content-Length":      "28",
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			for k, v := range test.header {
+				req.Header.Set(k, v)
+			}
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+
+			t.R.Equal(test.wantCode, res.Code, res.Body.String())
+			t.A.Equal(test.wantBody, res.Body.String())
+			for k, v := range test.wantHeader {
+				t.A.Equal(v, res.Result().Header.Get(k), k)
+			}
+		})
+	}
+
+	tt.Run("outside HTTP", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		out := &report{}
+		t.R.Nil(seekable.Interactor().Interact(context.Background(), reportRequest{Dog: "rex"}, out))
+		b, err := io.ReadAll(out.Content)
+		t.R.Nil(err)
+		t.A.Equal(content, string(b))
+	})
+
+	tt.Run("documented as binary", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		spec, err := json.Marshal(s.OpenAPI)
+		t.R.Nil(err)
+
+		var doc struct {
+			Paths map[string]map[string]struct {
+				Parameters []struct {
+					Name string `json:"name"`
+					In   string `json:"in"`
+				} `json:"parameters"`
+				Responses map[string]struct {
+					Headers map[string]any `json:"headers"`
+					Content map[string]struct {
+						Schema struct {
+							Type   string `json:"type"`
+							Format string `json:"format"`
+						} `json:"schema"`
+					} `json:"content"`
+				} `json:"responses"`
+			} `json:"paths"`
+		}
+		t.R.Nil(json.Unmarshal(spec, &doc))
+
+		op := doc.Paths["/reports/{dog}"]["get"]
+		for _, code := range []string{"200", "206"} {
+			t.R.Contains(op.Responses, code)
+			t.A.Equal("string", op.Responses[code].Content["text/csv"].Schema.Type, code)
+			t.A.Equal("binary", op.Responses[code].Content["text/csv"].Schema.Format, code)
+			t.A.Contains(op.Responses[code].Headers, "Content-Disposition", code)
+		}
+		t.A.Contains(op.Parameters, struct {
+			Name string `json:"name"`
+			In   string `json:"in"`
+		}{Name: "Range", In: "header"})
+		t.A.Contains(doc.Paths["/streams/{dog}"]["get"].Responses["200"].Content, MediaTypeOctetStream)
+	})
+}
+
+func TestParseSize(tt *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "512KB", want: 512 << 10},
+		{in: "10 mb", want: 10 << 20},
+		{in: "2GB", want: 2 << 30},
+		{in: "12B", want: 12},
+		{in: "ten", wantErr: true},
+		{in: "-1KB", wantErr: true},
+	}
+	for _, test := range tests {
+		tt.Run(test.in, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			got, err := ParseSize(test.in)
+			t.A.Equal(test.wantErr, err != nil)
+			t.A.Equal(test.want, got)
+		})
+	}
+}
+
+type badUpload struct {
+	Photo *multipart.FileHeader `formData:"photo" maxSize:"lots"`
+}
+
+func TestNew_badFileField(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	_, err := New(badUpload{}, &photoUploaded{}, func(ctx context.Context, input badUpload, output *photoUploaded) error {
+		return nil
+	}, nil, nil)
+	t.R.NotNil(err)
+	t.A.Contains(err.Error(), "badUpload.Photo maxSize")
+
+	// Validation reports it too rather than panicking
+	t.A.NotNil(checkFiles(&badUpload{}))
+}
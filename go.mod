@@ -1,15 +1,19 @@
 module github.com/muverum/usecase
 
-go 1.21
+go 1.22.0
 
 require (
 	github.com/go-chi/chi/v5 v5.0.10
+	github.com/gorilla/websocket v1.5.3
 	github.com/metrumresearchgroup/wrapt v0.0.2
 	github.com/sirupsen/logrus v1.9.0
+	github.com/swaggest/jsonschema-go v0.3.62
 	github.com/swaggest/openapi-go v0.2.41
 	github.com/swaggest/rest v0.2.59
 	github.com/swaggest/swgui v1.4.5
 	github.com/swaggest/usecase v1.2.1
+	golang.org/x/tools v0.26.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -20,13 +24,10 @@ require (
 	github.com/santhosh-tekuri/jsonschema/v3 v3.1.0 // indirect
 	github.com/stretchr/testify v1.8.2 // indirect
 	github.com/swaggest/form/v5 v5.1.1 // indirect
-	github.com/swaggest/jsonschema-go v0.3.62 // indirect
 	github.com/swaggest/refl v1.3.0 // indirect
 	github.com/vearutop/statigz v1.1.5 // indirect
-	golang.org/x/mod v0.4.2 // indirect
-	golang.org/x/sys v0.5.0 // indirect
-	golang.org/x/tools v0.1.7 // indirect
-	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	golang.org/x/mod v0.21.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
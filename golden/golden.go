@@ -0,0 +1,271 @@
+package golden
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/muverum/usecase/redact"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Interaction is a request served with the response it got, as kept in a golden file
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	// Path is the path and query the request was sent to
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body
+}
+
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body
+}
+
+// Body is JSON as it was sent, and anything else a JSON string with the Encoding it is in
+type Body struct {
+	Body json.RawMessage `json:"body,omitempty"`
+	// Encoding is EncodingText or EncodingBase64 for bodies which aren't JSON
+	Encoding string `json:"encoding,omitempty"`
+}
+
+const (
+	EncodingText   = "text"
+	EncodingBase64 = "base64"
+)
+
+func newBody(b []byte) Body {
+	switch {
+	case len(b) == 0:
+		return Body{}
+	case json.Valid(b):
+		var compact bytes.Buffer
+		_ = json.Compact(&compact, b)
+		return Body{Body: compact.Bytes()}
+	case utf8.Valid(b):
+		s, _ := json.Marshal(string(b))
+		return Body{Body: s, Encoding: EncodingText}
+	default:
+		s, _ := json.Marshal(base64.StdEncoding.EncodeToString(b))
+		return Body{Body: s, Encoding: EncodingBase64}
+	}
+}
+
+// Bytes returns the body as it was sent, JSON bodies being compacted
+func (b Body) Bytes() ([]byte, error) {
+	if b.Encoding == "" {
+		return b.Body, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b.Body, &s); err != nil {
+		return nil, err
+	}
+	if b.Encoding == EncodingBase64 {
+		return base64.StdEncoding.DecodeString(s)
+	}
+
+	return []byte(s), nil
+}
+
+// FileName is the name of the golden file of a route, such as post_dogs_{dog}_adoptions.json
+func FileName(method, pattern string) string {
+	name := strings.Trim(strings.NewReplacer("/", "_", "*", "", ":", "_").Replace(pattern), "_")
+	if name == "" {
+		return strings.ToLower(method) + ".json"
+	}
+
+	return strings.ToLower(method) + "_" + name + ".json"
+}
+
+// Load reads the interactions of a golden file
+func Load(path string) ([]Interaction, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var interactions []Interaction
+	if err := json.Unmarshal(b, &interactions); err != nil {
+		return nil, fmt.Errorf("golden file %s: %w", path, err)
+	}
+
+	return interactions, nil
+}
+
+// Recorder writes the requests it sees, with their responses, to a golden file per route in Dir. The first
+// request recorded to a route replaces the file left by an earlier run, later ones being added to it.
+//
+// JSON and form bodies are recorded with the fields named like secrets, such as password and token, masked
+// by redact, so a replayed request sends the mask in their place.
+type Recorder struct {
+	Dir string
+	// Headers are the request and response headers recorded besides Content-Type and Accept, such as Location.
+	// Others, Authorization among them, are left out, and those named like secrets are masked.
+	Headers []string
+	// Raw records bodies and headers unredacted, for requests which only replay with their secrets. The
+	// files then hold those secrets, so it is for test credentials only.
+	Raw bool
+
+	mu    sync.Mutex
+	files map[string][]Interaction
+}
+
+// Middleware records the requests which reach a route. Requests matching no route and upgrades to
+// WebSockets aren't recorded.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var out bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&out)
+
+		next.ServeHTTP(ww, r)
+
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil || rctx.RoutePattern() == "" {
+			return
+		}
+
+		i := Interaction{
+			Request: Request{
+				Method:  r.Method,
+				Path:    r.URL.RequestURI(),
+				Headers: rec.headers(r.Header, "Accept"),
+				Body:    newBody(rec.redact(body, r.Header.Get("Content-Type"))),
+			},
+			Response: Response{Status: ww.Status(), Headers: rec.headers(ww.Header())},
+		}
+		if i.Response.Status == 0 {
+			i.Response.Status = http.StatusOK
+		}
+
+		resBody := out.Bytes()
+		if ww.Header().Get("Content-Encoding") == "gzip" {
+			if resBody, err = gunzip(resBody); err != nil {
+				return
+			}
+		}
+		i.Response.Body = newBody(rec.redact(resBody, ww.Header().Get("Content-Type")))
+
+		// A failure to record must not affect the response, which has been written by now
+		_ = rec.record(FileName(r.Method, rctx.RoutePattern()), i)
+	})
+}
+
+func (rec *Recorder) headers(h http.Header, extra ...string) map[string]string {
+	out := map[string]string{}
+	for _, k := range append(append([]string{"Content-Type"}, extra...), rec.Headers...) {
+		if v := h.Get(k); v != "" {
+			out[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	if !rec.Raw {
+		for k, v := range redact.Value(out).(map[string]any) {
+			out[k] = fmt.Sprint(v)
+		}
+	}
+
+	return out
+}
+
+// redact masks the fields of a JSON or form body which are named like secrets, leaving other bodies as
+// they are
+func (rec *Recorder) redact(b []byte, contentType string) []byte {
+	if rec.Raw || len(b) == 0 {
+		return b
+	}
+
+	if json.Valid(b) {
+		d := json.NewDecoder(bytes.NewReader(b))
+		// Numbers are kept as they were written rather than as float64
+		d.UseNumber()
+		var v any
+		if err := d.Decode(&v); err != nil {
+			return b
+		}
+		out, err := redact.JSON(v)
+		if err != nil {
+			return b
+		}
+		return out
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(b))
+		if err != nil {
+			return b
+		}
+		out := url.Values{}
+		for k, v := range redact.Value(map[string][]string(values)).(map[string]any) {
+			for _, e := range v.([]any) {
+				out.Add(k, fmt.Sprint(e))
+			}
+		}
+		return []byte(out.Encode())
+	}
+
+	return b
+}
+
+func (rec *Recorder) record(name string, i Interaction) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.files == nil {
+		rec.files = map[string][]Interaction{}
+	}
+	rec.files[name] = append(rec.files[name], i)
+
+	b, err := json.MarshalIndent(rec.files[name], "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(rec.Dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(rec.Dir, name), append(b, '\n'), 0o644)
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,245 @@
+package golden
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/metrumresearchgroup/wrapt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRouter(rec *Recorder) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	if rec != nil {
+		r.Use(rec.Middleware)
+	}
+
+	r.Post("/dogs/{dog}/adoptions", func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/dogs/"+chi.URLParam(r, "dog"))
+		w.Header().Set("X-Request-Id", middleware.GetReqID(r.Context()))
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"dog":     chi.URLParam(r, "dog"),
+			"adopter": in["adopter"],
+			"meta":    map[string]any{"adoptedAt": time.Now().Format(time.RFC3339Nano)},
+		})
+	})
+	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"user": in.Username, "token": "t-" + in.Password, "expiresIn": 3600})
+	})
+	r.Post("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Get("/dogs/{dog}/photo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte{0x89, 'P', 'N', 'G', 0xff, 0x00})
+	})
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			_, _ = w.Write([]byte("all good"))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte("all good"))
+		_ = gz.Close()
+	})
+
+	return r
+}
+
+func TestRecorder(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	dir := filepath.Join(tt.TempDir(), "testdata")
+	// A file from an earlier run is replaced
+	t.R.Nil(os.MkdirAll(dir, 0o755))
+	t.R.Nil(os.WriteFile(filepath.Join(dir, "get_report.json"), []byte(`[{"request":{"method":"GET","path":"/old"}}]`), 0o644))
+
+	h := testRouter(&Recorder{Dir: dir, Headers: []string{"Location", "Cookie"}})
+	send := func(method, path, body string, headers ...string) {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k := 0; k+1 < len(headers); k += 2 {
+			r.Header.Set(headers[k], headers[k+1])
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, r)
+	}
+	send(http.MethodPost, "/dogs/rex/adoptions?notify=true", `{ "adopter": "sam" }`, "Content-Type", "application/json", "Authorization", "Bearer x")
+	send(http.MethodPost, "/dogs/fido/adoptions", `{"adopter":"alex"}`, "Content-Type", "application/json")
+	send(http.MethodGet, "/dogs/rex/photo", "")
+	send(http.MethodGet, "/report", "", "Accept-Encoding", "gzip")
+	send(http.MethodGet, "/missing", "")
+	send(http.MethodPost, "/login", `{"username":"sam","password":"hunter2"}`, "Content-Type", "application/json", "Cookie", "session=abc")
+	send(http.MethodPost, "/sessions", "user=sam&password=hunter2", "Content-Type", "application/x-www-form-urlencoded")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	t.R.Nil(err)
+	for k := range files {
+		files[k] = filepath.Base(files[k])
+	}
+	t.A.Equal([]string{"get_dogs_{dog}_photo.json", "get_report.json", "post_dogs_{dog}_adoptions.json", "post_login.json", "post_sessions.json"}, files)
+
+	adoptions, err := Load(filepath.Join(dir, "post_dogs_{dog}_adoptions.json"))
+	t.R.Nil(err)
+	t.R.Len(adoptions, 2)
+	first := adoptions[0]
+	t.A.Equal("/dogs/rex/adoptions?notify=true", first.Request.Path)
+	t.A.Equal(map[string]string{"Content-Type": "application/json"}, first.Request.Headers)
+	t.A.JSONEq(`{"adopter":"sam"}`, string(first.Request.Body.Body))
+	t.A.Equal(http.StatusCreated, first.Response.Status)
+	t.A.Equal(map[string]string{"Content-Type": "application/json", "Location": "/dogs/rex"}, first.Response.Headers)
+	t.A.Contains(string(first.Response.Body.Body), `"dog": "rex"`)
+
+	photo, err := Load(filepath.Join(dir, "get_dogs_{dog}_photo.json"))
+	t.R.Nil(err)
+	t.R.Len(photo, 1)
+	t.A.Equal(EncodingBase64, photo[0].Response.Encoding)
+	b, err := photo[0].Response.Bytes()
+	t.R.Nil(err)
+	t.A.Equal([]byte{0x89, 'P', 'N', 'G', 0xff, 0x00}, b)
+
+	report, err := Load(filepath.Join(dir, "get_report.json"))
+	t.R.Nil(err)
+	t.R.Len(report, 1)
+	t.A.Equal(Body{Body: []byte(`"all good"`), Encoding: EncodingText}, report[0].Response.Body)
+
+	login, err := Load(filepath.Join(dir, "post_login.json"))
+	t.R.Nil(err)
+	t.R.Len(login, 1)
+	t.A.JSONEq(`{"username":"sam","password":"[REDACTED]"}`, string(login[0].Request.Body.Body))
+	t.A.Equal("[REDACTED]", login[0].Request.Headers["Cookie"])
+	t.A.JSONEq(`{"user":"sam","token":"[REDACTED]","expiresIn":3600}`, string(login[0].Response.Body.Body))
+
+	sessions, err := Load(filepath.Join(dir, "post_sessions.json"))
+	t.R.Nil(err)
+	t.R.Len(sessions, 1)
+	b, err = sessions[0].Request.Bytes()
+	t.R.Nil(err)
+	t.A.Equal("password=%5BREDACTED%5D&user=sam", string(b))
+
+	// What was recorded replays against a fresh handler, the volatile parts aside
+	Replay(tt, testRouter(nil), dir, "adoptedAt", "X-Request-Id")
+}
+
+func TestRecorder_Raw(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	dir := tt.TempDir()
+	h := testRouter(&Recorder{Dir: dir, Raw: true})
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"sam","password":"hunter2"}`))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	login, err := Load(filepath.Join(dir, "post_login.json"))
+	t.R.Nil(err)
+	t.R.Len(login, 1)
+	t.A.JSONEq(`{"username":"sam","password":"hunter2"}`, string(login[0].Request.Body.Body))
+	t.A.JSONEq(`{"user":"sam","token":"t-hunter2","expiresIn":3600}`, string(login[0].Response.Body.Body))
+
+	Replay(tt, testRouter(nil), dir)
+}
+
+func TestDiff(tt *testing.T) {
+	want := Response{
+		Status:  http.StatusOK,
+		Headers: map[string]string{"Content-Type": "application/json", "X-Request-Id": "a"},
+		Body:    newBody([]byte(`{"dog":"rex","at":"2026-01-01","items":[{"id":1,"at":"x"}]}`)),
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		body    string
+		want    []string
+	}{
+		{
+			name:    "same but for ignored fields",
+			status:  http.StatusOK,
+			headers: map[string]string{"Content-Type": "application/json", "X-Request-Id": "b"},
+			body:    `{"items":[{"at":"y","id":1}],"dog":"rex","at":"2026-10-19"}`,
+		},
+		{
+			name:    "status",
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": "application/json"},
+			body:    `{"dog":"rex","items":[{"id":1}]}`,
+			want:    []string{"status 404, want 200"},
+		},
+		{
+			name:    "header",
+			status:  http.StatusOK,
+			headers: map[string]string{"Content-Type": "text/csv"},
+			body:    `{"dog":"rex","items":[{"id":1}]}`,
+			want:    []string{`header Content-Type "text/csv", want "application/json"`},
+		},
+		{
+			name:    "nested field",
+			status:  http.StatusOK,
+			headers: map[string]string{"Content-Type": "application/json"},
+			body:    `{"dog":"rex","items":[{"id":2}]}`,
+			want:    []string{"body\n{\n  \"dog\": \"rex\",\n  \"items\": [\n    {\n      \"id\": 2\n    }\n  ]\n}\nwant\n{\n  \"dog\": \"rex\",\n  \"items\": [\n    {\n      \"id\": 1\n    }\n  ]\n}"},
+		},
+		{
+			name:    "not JSON",
+			status:  http.StatusOK,
+			headers: map[string]string{"Content-Type": "application/json"},
+			body:    `oops`,
+			want:    []string{`body "oops", want {"dog":"rex","at":"2026-01-01","items":[{"id":1,"at":"x"}]}`},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			got := &http.Response{StatusCode: test.status, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString(test.body))}
+			for k, v := range test.headers {
+				got.Header.Set(k, v)
+			}
+
+			t.A.Equal(test.want, diff(want, got, map[string]bool{"at": true, "x-request-id": true}))
+		})
+	}
+}
+
+func TestFileName(tt *testing.T) {
+	tests := []struct {
+		method  string
+		pattern string
+		want    string
+	}{
+		{method: http.MethodGet, pattern: "/", want: "get.json"},
+		{method: http.MethodPost, pattern: "/dogs/{dog}/adoptions", want: "post_dogs_{dog}_adoptions.json"},
+		{method: http.MethodGet, pattern: "/v1/dog/walk/{place}/{times}", want: "get_v1_dog_walk_{place}_{times}.json"},
+		{method: http.MethodGet, pattern: "/files/*", want: "get_files.json"},
+	}
+	for _, test := range tests {
+		tt.Run(fmt.Sprintf("%s %s", test.method, test.pattern), func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			t.A.Equal(test.want, FileName(test.method, test.pattern))
+		})
+	}
+}
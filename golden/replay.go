@@ -0,0 +1,144 @@
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/muverum/usecase/redact"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Replay sends the interactions of the golden files in dir to the handler again, in the order they were
+// recorded, and fails those whose responses differ from the recorded ones. Each file is a subtest, and each
+// of its interactions one within it. Ignore names the headers, and the JSON fields at any depth, whose values
+// change from one response to the next, such as timestamps and request IDs. Headers and JSON fields named
+// like secrets are compared masked, as the Recorder wrote them.
+func Replay(t *testing.T, h http.Handler, dir string, ignore ...string) {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no golden files in %s", dir)
+	}
+
+	ignored := map[string]bool{}
+	for _, v := range ignore {
+		ignored[strings.ToLower(v)] = true
+	}
+
+	for _, file := range files {
+		interactions, err := Load(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			for k, i := range interactions {
+				t.Run(strconv.Itoa(k), func(t *testing.T) {
+					got, err := replay(h, i.Request)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for _, d := range diff(i.Response, got, ignored) {
+						t.Errorf("%s %s: %s", i.Request.Method, i.Request.Path, d)
+					}
+				})
+			}
+		})
+	}
+}
+
+// replay sends a recorded request to the handler in process
+func replay(h http.Handler, req Request) (*http.Response, error) {
+	body, err := req.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	r := httptest.NewRequest(req.Method, req.Path, bytes.NewReader(body))
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w.Result(), nil
+}
+
+// diff describes how a response differs from the recorded one, leaving out the ignored headers and fields
+// and masking those named like secrets on both sides
+func diff(want Response, got *http.Response, ignored map[string]bool) []string {
+	var out []string
+	if want.Status != got.StatusCode {
+		out = append(out, fmt.Sprintf("status %d, want %d", got.StatusCode, want.Status))
+	}
+
+	gotHeaders := map[string]string{}
+	for k := range want.Headers {
+		gotHeaders[k] = got.Header.Get(k)
+	}
+	wantHeaders, masked := redact.Value(want.Headers).(map[string]any), redact.Value(gotHeaders).(map[string]any)
+	for k := range want.Headers {
+		if w, g := fmt.Sprint(wantHeaders[k]), fmt.Sprint(masked[k]); !ignored[strings.ToLower(k)] && g != w {
+			out = append(out, fmt.Sprintf("header %s %q, want %q", k, g, w))
+		}
+	}
+
+	b := new(bytes.Buffer)
+	if _, err := b.ReadFrom(got.Body); err != nil {
+		return append(out, err.Error())
+	}
+	gotBody := newBody(b.Bytes())
+
+	if isJSON(want.Body) && isJSON(gotBody) {
+		var w, g any
+		_ = json.Unmarshal(want.Body.Body, &w)
+		_ = json.Unmarshal(gotBody.Body, &g)
+		if w, g = redact.Value(scrub(w, ignored)), redact.Value(scrub(g, ignored)); !reflect.DeepEqual(w, g) {
+			wb, _ := json.MarshalIndent(w, "", "  ")
+			gb, _ := json.MarshalIndent(g, "", "  ")
+			out = append(out, fmt.Sprintf("body\n%s\nwant\n%s", gb, wb))
+		}
+		return out
+	}
+
+	if !bytes.Equal(want.Body.Body, gotBody.Body) || want.Encoding != gotBody.Encoding {
+		out = append(out, fmt.Sprintf("body %s, want %s", gotBody.Body, want.Body.Body))
+	}
+
+	return out
+}
+
+func isJSON(b Body) bool {
+	return len(b.Body) > 0 && b.Encoding == ""
+}
+
+// scrub removes the ignored fields from a decoded JSON value, keys being matched regardless of case
+func scrub(v any, ignored map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if ignored[strings.ToLower(k)] {
+				delete(v, k)
+				continue
+			}
+			v[k] = scrub(e, ignored)
+		}
+	case []any:
+		for k, e := range v {
+			v[k] = scrub(e, ignored)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,215 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFailing  = "failing"
+)
+
+// Check is a named probe of a dependency
+type Check struct {
+	Name string
+	Func func(ctx context.Context) error
+	// Timeout bounds a single run of Func, defaults to 5 seconds
+	Timeout time.Duration
+	// Critical checks fail the probe when they fail, others only mark it degraded
+	Critical bool
+	// Liveness includes the check in /healthz as well as /readyz. Only checks whose failure means the
+	// process itself needs restarting belong here.
+	Liveness bool
+	// CacheFor reuses the last result for this long so probes don't hammer dependencies
+	CacheFor time.Duration
+}
+
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Critical bool    `json:"critical"`
+	Error    string  `json:"error,omitempty"`
+	Latency  float64 `json:"latencyMs"`
+	Cached   bool    `json:"cached,omitempty"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+type check struct {
+	Check
+	mu      sync.Mutex
+	last    Result
+	checked time.Time
+}
+
+// Registry holds the checks backing the liveness and readiness probes
+type Registry struct {
+	mu           sync.RWMutex
+	checks       []*check
+	shuttingDown atomic.Bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(checks ...Check) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range checks {
+		if c.Name == "" || c.Func == nil {
+			return fmt.Errorf("health checks require a name and a func")
+		}
+
+		for _, v := range r.checks {
+			if v.Name == c.Name {
+				return fmt.Errorf("health check %s is already registered", c.Name)
+			}
+		}
+
+		if c.Timeout <= 0 {
+			c.Timeout = 5 * time.Second
+		}
+
+		r.checks = append(r.checks, &check{Check: c})
+	}
+
+	return nil
+}
+
+// SetShuttingDown makes readiness fail regardless of the checks so that traffic drains before shutdown
+func (r *Registry) SetShuttingDown(shuttingDown bool) {
+	r.shuttingDown.Store(shuttingDown)
+}
+
+func (r *Registry) ShuttingDown() bool {
+	return r.shuttingDown.Load()
+}
+
+// Run executes the checks concurrently, liveness restricts it to the checks flagged for liveness
+func (r *Registry) Run(ctx context.Context, liveness bool) Report {
+	r.mu.RLock()
+	var checks []*check
+	for _, v := range r.checks {
+		if !liveness || v.Liveness {
+			checks = append(checks, v)
+		}
+	}
+	r.mu.RUnlock()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make([]Result, len(checks)),
+	}
+
+	wg := sync.WaitGroup{}
+	for k, v := range checks {
+		wg.Add(1)
+		go func(k int, c *check) {
+			defer wg.Done()
+			report.Checks[k] = c.run(ctx)
+		}(k, v)
+	}
+	wg.Wait()
+
+	for _, v := range report.Checks {
+		if v.Status == StatusOK {
+			continue
+		}
+		if v.Critical {
+			report.Status = StatusFailing
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.CacheFor > 0 && !c.checked.IsZero() && time.Since(c.checked) < c.CacheFor {
+		cached := c.last
+		cached.Cached = true
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		// A panicking check fails rather than taking the process down with it
+		defer func() {
+			if v := recover(); v != nil {
+				done <- fmt.Errorf("panic: %v", v)
+			}
+		}()
+		done <- c.Func(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", c.Timeout)
+	}
+
+	c.last = Result{
+		Name:     c.Name,
+		Status:   StatusOK,
+		Critical: c.Critical,
+		Latency:  float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		c.last.Status = StatusFailing
+		c.last.Error = err.Error()
+	}
+	c.checked = time.Now()
+
+	return c.last
+}
+
+// Liveness serves /healthz, failing only when a critical liveness check fails
+func (r *Registry) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		write(w, r.Run(req.Context(), true), false)
+	})
+}
+
+// Readiness serves /readyz, failing when a critical check fails or the service is shutting down
+func (r *Registry) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		write(w, r.Run(req.Context(), false), r.ShuttingDown())
+	})
+}
+
+func write(w http.ResponseWriter, report Report, shuttingDown bool) {
+	code := http.StatusOK
+	if shuttingDown {
+		report.Status = StatusFailing
+		report.Checks = append(report.Checks, Result{Name: "shutdown", Status: StatusFailing, Critical: true, Error: "shutting down"})
+	}
+	if report.Status == StatusFailing {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,153 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/metrumresearchgroup/wrapt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Register(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	r := NewRegistry()
+	ok := func(ctx context.Context) error { return nil }
+
+	t.A.Nil(r.Register(Check{Name: "db", Func: ok}))
+	t.A.NotNil(r.Register(Check{Name: "db", Func: ok}))
+	t.A.NotNil(r.Register(Check{Name: "nofunc"}))
+}
+
+func TestRegistry_Handlers(tt *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	broken := func(ctx context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}
+	panicking := func(ctx context.Context) error {
+		var pool map[string]int
+		pool["conns"]++
+		return nil
+	}
+
+	tests := []struct {
+		name          string
+		checks        []Check
+		shuttingDown  bool
+		handler       func(r *Registry) http.Handler
+		wantCode      int
+		assertionFunc func(t *wrapt.T, report Report)
+	}{
+		{
+			name:     "all passing",
+			checks:   []Check{{Name: "db", Func: ok, Critical: true}, {Name: "cache", Func: ok}},
+			handler:  (*Registry).Readiness,
+			wantCode: http.StatusOK,
+			assertionFunc: func(t *wrapt.T, report Report) {
+				t.A.Equal(StatusOK, report.Status)
+				t.R.Len(report.Checks, 2)
+				t.A.Equal("db", report.Checks[0].Name)
+				t.A.GreaterOrEqual(report.Checks[0].Latency, float64(0))
+			},
+		},
+		{
+			name:     "non critical failure degrades",
+			checks:   []Check{{Name: "db", Func: ok, Critical: true}, {Name: "cache", Func: broken}},
+			handler:  (*Registry).Readiness,
+			wantCode: http.StatusOK,
+			assertionFunc: func(t *wrapt.T, report Report) {
+				t.A.Equal(StatusDegraded, report.Status)
+				t.A.Equal("connection refused", report.Checks[1].Error)
+			},
+		},
+		{
+			name:     "critical failure fails",
+			checks:   []Check{{Name: "db", Func: broken, Critical: true}},
+			handler:  (*Registry).Readiness,
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "timeouts fail the check",
+			checks:   []Check{{Name: "db", Func: slow, Critical: true, Timeout: 10 * time.Millisecond}},
+			handler:  (*Registry).Readiness,
+			wantCode: http.StatusServiceUnavailable,
+			assertionFunc: func(t *wrapt.T, report Report) {
+				t.A.Contains(report.Checks[0].Error, "timed out")
+			},
+		},
+		{
+			name:     "panics fail the check",
+			checks:   []Check{{Name: "db", Func: ok, Critical: true}, {Name: "pool", Func: panicking, Critical: true}},
+			handler:  (*Registry).Readiness,
+			wantCode: http.StatusServiceUnavailable,
+			assertionFunc: func(t *wrapt.T, report Report) {
+				t.A.Equal(StatusOK, report.Checks[0].Status)
+				t.A.Equal(StatusFailing, report.Checks[1].Status)
+				t.A.Contains(report.Checks[1].Error, "panic: assignment to entry in nil map")
+			},
+		},
+		{
+			name:     "liveness only runs liveness checks",
+			checks:   []Check{{Name: "db", Func: broken, Critical: true}, {Name: "deadlock", Func: ok, Critical: true, Liveness: true}},
+			handler:  (*Registry).Liveness,
+			wantCode: http.StatusOK,
+			assertionFunc: func(t *wrapt.T, report Report) {
+				t.R.Len(report.Checks, 1)
+				t.A.Equal("deadlock", report.Checks[0].Name)
+			},
+		},
+		{
+			name:         "shutting down fails readiness",
+			checks:       []Check{{Name: "db", Func: ok, Critical: true}},
+			shuttingDown: true,
+			handler:      (*Registry).Readiness,
+			wantCode:     http.StatusServiceUnavailable,
+		},
+		{
+			name:         "shutting down leaves liveness alone",
+			shuttingDown: true,
+			handler:      (*Registry).Liveness,
+			wantCode:     http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			r := NewRegistry()
+			t.R.Nil(r.Register(test.checks...))
+			r.SetShuttingDown(test.shuttingDown)
+
+			rec := httptest.NewRecorder()
+			test.handler(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			t.A.Equal(test.wantCode, rec.Code)
+
+			var report Report
+			t.R.Nil(json.NewDecoder(rec.Body).Decode(&report))
+			if test.assertionFunc != nil {
+				test.assertionFunc(t, report)
+			}
+		})
+	}
+}
+
+func TestCheck_CacheFor(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	var calls atomic.Int32
+	r := NewRegistry()
+	t.R.Nil(r.Register(Check{Name: "db", CacheFor: time.Minute, Func: func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}}))
+
+	first := r.Run(context.Background(), false)
+	second := r.Run(context.Background(), false)
+
+	t.A.Equal(int32(1), calls.Load())
+	t.A.False(first.Checks[0].Cached)
+	t.A.True(second.Checks[0].Cached)
+}
@@ -0,0 +1,377 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"github.com/swaggest/openapi-go"
+	"github.com/swaggest/openapi-go/openapi3"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/rest/nethttp"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Operator compares a field to the values of a Condition
+type Operator string
+
+const (
+	OpEq       Operator = "eq"
+	OpNe       Operator = "ne"
+	OpGt       Operator = "gt"
+	OpGte      Operator = "gte"
+	OpLt       Operator = "lt"
+	OpLte      Operator = "lte"
+	OpIn       Operator = "in"
+	OpContains Operator = "contains"
+	OpPrefix   Operator = "prefix"
+)
+
+var operators = map[Operator]string{
+	OpEq:       "equal to",
+	OpNe:       "not equal to",
+	OpGt:       "greater than",
+	OpGte:      "greater than or equal to",
+	OpLt:       "less than",
+	OpLte:      "less than or equal to",
+	OpIn:       "one of the comma separated",
+	OpContains: "containing",
+	OpPrefix:   "starting with",
+}
+
+// Condition is a single filter[field][op]=value of a list query. Values has one value, or those
+// separated by commas for OpIn.
+type Condition struct {
+	Field  string
+	Op     Operator
+	Values []string
+}
+
+// Value is the first of the values
+func (c Condition) Value() string {
+	if len(c.Values) == 0 {
+		return ""
+	}
+
+	return c.Values[0]
+}
+
+// Filter is the conditions of a list query, every one of which an item has to meet
+type Filter []Condition
+
+// On returns the conditions on the field
+func (f Filter) On(field string) Filter {
+	var out Filter
+	for _, c := range f {
+		if c.Field == field {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// SortKey is a field of a list query's sort, descending when given as -field
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Sort is the order of a list query, by the first key then by each following one
+type Sort []SortKey
+
+// ListQuery is embedded in the input of a list use case, with the fields it can be filtered on and
+// sorted by declared in its tags:
+//
+//	usecase.ListQuery `filter:"name:eq,contains;age:gt,lt" sort:"name,age"`
+//
+// Over HTTP it is parsed from filter[field][op]=value query parameters, filter[field]=value meaning eq,
+// and sort=-age,name. Fields or operators which aren't allowed are answered with 400.
+type ListQuery struct {
+	Filter Filter `json:"-"`
+	Sort   Sort   `json:"-"`
+}
+
+func (q *ListQuery) listQuery() *ListQuery {
+	return q
+}
+
+type listQuerier interface {
+	listQuery() *ListQuery
+}
+
+// QueryError is answered with 400 and the problems keyed by query parameter in the error context
+type QueryError struct {
+	Errors rest.ValidationErrors
+}
+
+func (e *QueryError) Error() string {
+	return "invalid list query"
+}
+
+func (e *QueryError) Status() status.Code {
+	return status.InvalidArgument
+}
+
+func (e *QueryError) HTTPStatus() int {
+	return http.StatusBadRequest
+}
+
+func (e *QueryError) Fields() map[string]interface{} {
+	return e.Errors.Fields()
+}
+
+// queryAllowlist is read from the tags of the ListQuery field of an input type
+type queryAllowlist struct {
+	filter map[string][]Operator
+	sort   []string
+}
+
+type queryAllowlistOf struct {
+	allow queryAllowlist
+	err   error
+}
+
+var queryAllowlistCache sync.Map
+
+// allowlistOf reads the allowlist of an input type, or of the type it points to, failing when its tags
+// can't be parsed
+func allowlistOf(t reflect.Type) (queryAllowlist, error) {
+	if t == nil {
+		return queryAllowlist{}, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if v, ok := queryAllowlistCache.Load(t); ok {
+		return v.(queryAllowlistOf).allow, v.(queryAllowlistOf).err
+	}
+
+	var (
+		allow queryAllowlist
+		err   error
+	)
+	if t.Kind() == reflect.Struct {
+		if sf, ok := t.FieldByName("ListQuery"); ok && sf.Anonymous && sf.Type == reflect.TypeOf(ListQuery{}) {
+			if allow, err = parseAllowlist(sf.Tag.Get("filter"), sf.Tag.Get("sort")); err != nil {
+				err = fmt.Errorf("%s.ListQuery: %w", t, err)
+			}
+		}
+	}
+
+	queryAllowlistCache.Store(t, queryAllowlistOf{allow: allow, err: err})
+	return allow, err
+}
+
+func parseAllowlist(filter, sorts string) (queryAllowlist, error) {
+	allow := queryAllowlist{filter: map[string][]Operator{}}
+	for _, v := range strings.Split(filter, ";") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		field, ops, ok := strings.Cut(v, ":")
+		if !ok {
+			return allow, fmt.Errorf("filter %q has no operators", v)
+		}
+		for _, op := range strings.Split(ops, ",") {
+			op := Operator(strings.TrimSpace(op))
+			if _, ok := operators[op]; !ok {
+				return allow, fmt.Errorf("filter %q has unknown operator %q", v, op)
+			}
+			allow.filter[strings.TrimSpace(field)] = append(allow.filter[strings.TrimSpace(field)], op)
+		}
+	}
+
+	for _, v := range strings.Split(sorts, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			allow.sort = append(allow.sort, v)
+		}
+	}
+
+	return allow, nil
+}
+
+var filterParam = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+// ParseListQuery reads the filter and sort query parameters, leaving the allowlist to be checked
+func ParseListQuery(query url.Values) (ListQuery, error) {
+	var q ListQuery
+	problems := rest.ValidationErrors{}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k != "filter" && !strings.HasPrefix(k, "filter[") {
+			continue
+		}
+
+		m := filterParam.FindStringSubmatch(k)
+		if m == nil {
+			problems["query:"+k] = append(problems["query:"+k], "expected filter[field][op]")
+			continue
+		}
+
+		op := Operator(m[2])
+		if op == "" {
+			op = OpEq
+		}
+		for _, v := range query[k] {
+			values := []string{v}
+			if op == OpIn {
+				values = strings.Split(v, ",")
+			}
+			q.Filter = append(q.Filter, Condition{Field: m[1], Op: op, Values: values})
+		}
+	}
+
+	for _, v := range query["sort"] {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key == "" {
+				continue
+			}
+			// A single - or + prefix gives the direction, so --age is left for the allowlist to refuse
+			k := SortKey{Field: key}
+			switch key[0] {
+			case '-':
+				k = SortKey{Field: key[1:], Desc: true}
+			case '+':
+				k.Field = key[1:]
+			}
+			q.Sort = append(q.Sort, k)
+		}
+	}
+
+	if len(problems) > 0 {
+		return q, &QueryError{Errors: problems}
+	}
+
+	return q, nil
+}
+
+// check reports the conditions and sort keys which the allowlist doesn't have
+func (a queryAllowlist) check(q ListQuery) error {
+	problems := rest.ValidationErrors{}
+	for _, c := range q.Filter {
+		key := fmt.Sprintf("query:filter[%s][%s]", c.Field, c.Op)
+		ops, ok := a.filter[c.Field]
+		switch {
+		case !ok:
+			problems[key] = append(problems[key], fmt.Sprintf("unknown filter field %s", c.Field))
+		case !slices.Contains(ops, c.Op):
+			problems[key] = append(problems[key], fmt.Sprintf("%s can't be filtered with %s", c.Field, c.Op))
+		}
+	}
+
+	for _, k := range q.Sort {
+		if !slices.Contains(a.sort, k.Field) {
+			problems["query:sort"] = append(problems["query:sort"], fmt.Sprintf("unknown sort field %s", k.Field))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &QueryError{Errors: problems}
+	}
+
+	return nil
+}
+
+func (i UseCase[I, O]) listQueried() bool {
+	var in I
+	_, ok := any(&in).(listQuerier)
+	return ok
+}
+
+// listQuery parses the list query of an input from the request, when there is one, and checks it
+// against the allowlist of the input type
+func (i UseCase[I, O]) listQuery(ctx context.Context, input *I) error {
+	l, ok := any(input).(listQuerier)
+	if !ok {
+		return nil
+	}
+
+	q := l.listQuery()
+	if r, _ := ctx.Value(requestKey{}).(*http.Request); r != nil {
+		parsed, err := ParseListQuery(r.URL.Query())
+		if err != nil {
+			return err
+		}
+		*q = parsed
+	}
+
+	allow, err := allowlistOf(reflect.TypeOf(i.input))
+	if err != nil {
+		return err
+	}
+
+	return allow.check(*q)
+}
+
+// AnnotateListQuery documents the filter and sort query parameters the allowlist accepts
+func AnnotateListQuery(input any) func(oc openapi.OperationContext) error {
+	allow, err := allowlistOf(reflect.TypeOf(input))
+
+	return func(oc openapi.OperationContext) error {
+		if err != nil {
+			return err
+		}
+
+		o3, ok := oc.(openapi3.OperationExposer)
+		if !ok {
+			return nil
+		}
+
+		str := openapi3.SchemaTypeString
+		op := o3.Operation()
+
+		fields := make([]string, 0, len(allow.filter))
+		for field := range allow.filter {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			for _, o := range allow.filter[field] {
+				op.Parameters = append(op.Parameters, openapi3.ParameterOrRef{Parameter: &openapi3.Parameter{
+					Name:        fmt.Sprintf("filter[%s][%s]", field, o),
+					In:          openapi3.ParameterInQuery,
+					Description: ptr(fmt.Sprintf("Items with %s %s the value.", field, operators[o])),
+					Schema:      &openapi3.SchemaOrRef{Schema: &openapi3.Schema{Type: &str}},
+				}})
+			}
+		}
+
+		if len(allow.sort) > 0 {
+			keys := make([]string, len(allow.sort))
+			for k, v := range allow.sort {
+				keys[k] = regexp.QuoteMeta(v)
+			}
+			key := "[-+]?(" + strings.Join(keys, "|") + ")"
+			op.Parameters = append(op.Parameters, openapi3.ParameterOrRef{Parameter: &openapi3.Parameter{
+				Name:        "sort",
+				In:          openapi3.ParameterInQuery,
+				Description: ptr(fmt.Sprintf("Comma separated fields to sort by, descending when prefixed with -, out of %s.", strings.Join(allow.sort, ", "))),
+				Schema:      &openapi3.SchemaOrRef{Schema: &openapi3.Schema{Type: &str, Pattern: ptr("^" + key + "(," + key + ")*$")}},
+			}})
+		}
+
+		return nil
+	}
+}
+
+func (i UseCase[I, O]) listQueryHandlerOptions() []func(h *nethttp.Handler) {
+	if !i.listQueried() {
+		return nil
+	}
+
+	return []func(h *nethttp.Handler){nethttp.AnnotateOpenAPIOperation(AnnotateListQuery(i.input))}
+}
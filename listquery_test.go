@@ -0,0 +1,217 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/swaggest/rest/web"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseListQuery(tt *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter Filter
+		wantSort   Sort
+		wantErr    bool
+	}{
+		{name: "empty", query: ""},
+		{
+			name:  "filters",
+			query: "filter[age][gt]=3&filter[name]=rex&filter[breed][in]=collie,pug",
+			wantFilter: Filter{
+				{Field: "age", Op: OpGt, Values: []string{"3"}},
+				{Field: "breed", Op: OpIn, Values: []string{"collie", "pug"}},
+				{Field: "name", Op: OpEq, Values: []string{"rex"}},
+			},
+		},
+		{
+			name:     "sort",
+			query:    "sort=-age,name,+breed",
+			wantSort: Sort{{Field: "age", Desc: true}, {Field: "name"}, {Field: "breed"}},
+		},
+		{
+			name:     "one direction prefix",
+			query:    "sort=--age,%2B-name",
+			wantSort: Sort{{Field: "-age", Desc: true}, {Field: "-name"}},
+		},
+		{name: "other parameters", query: "filtered=yes&limit=3"},
+		{name: "malformed", query: "filter[age=3", wantErr: true},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			query, err := url.ParseQuery(test.query)
+			t.R.Nil(err)
+
+			got, err := ParseListQuery(query)
+			t.A.Equal(test.wantErr, err != nil)
+			t.A.Equal(test.wantFilter, got.Filter)
+			t.A.Equal(test.wantSort, got.Sort)
+		})
+	}
+}
+
+type dogSearch struct {
+	ListQuery `filter:"name:eq,contains;age:gt,lt" sort:"name,age"`
+	PageRequest
+}
+
+type dogSearchResult struct {
+	Filter Filter `json:"filter"`
+	Sort   Sort   `json:"sort"`
+}
+
+func TestUseCase_ListQuery(tt *testing.T) {
+	uc, err := New(dogSearch{}, &dogSearchResult{}, func(ctx context.Context, input dogSearch, output *dogSearchResult) error {
+		output.Filter = input.Filter
+		output.Sort = input.Sort
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	s := web.DefaultService()
+	s.Method(http.MethodGet, "/dogs", uc.Handler())
+
+	tests := []struct {
+		name        string
+		query       string
+		wantCode    int
+		wantResult  dogSearchResult
+		wantContext map[string][]string
+	}{
+		{
+			name:     "allowed",
+			query:    "filter[name][contains]=re&filter[age][lt]=5&sort=-age&limit=10",
+			wantCode: http.StatusOK,
+			wantResult: dogSearchResult{
+				Filter: Filter{{Field: "age", Op: OpLt, Values: []string{"5"}}, {Field: "name", Op: OpContains, Values: []string{"re"}}},
+				Sort:   Sort{{Field: "age", Desc: true}},
+			},
+		},
+		{
+			name:     "unknown field and operator",
+			query:    "filter[owner]=sam&filter[age][eq]=3&sort=name,weight",
+			wantCode: http.StatusBadRequest,
+			wantContext: map[string][]string{
+				"query:filter[owner][eq]": {"unknown filter field owner"},
+				"query:filter[age][eq]":   {"age can't be filtered with eq"},
+				"query:sort":              {"unknown sort field weight"},
+			},
+		},
+		{
+			name:        "repeated direction prefix",
+			query:       "sort=--age",
+			wantCode:    http.StatusBadRequest,
+			wantContext: map[string][]string{"query:sort": {"unknown sort field -age"}},
+		},
+		{
+			name:        "malformed",
+			query:       "filter[age][gt][x]=3",
+			wantCode:    http.StatusBadRequest,
+			wantContext: map[string][]string{"query:filter[age][gt][x]": {"expected filter[field][op]"}},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/dogs?"+test.query, nil))
+
+			t.R.Equal(test.wantCode, res.Code, res.Body.String())
+			if test.wantCode == http.StatusOK {
+				var got dogSearchResult
+				t.R.Nil(json.Unmarshal(res.Body.Bytes(), &got))
+				t.A.Equal(test.wantResult, got)
+			}
+			if test.wantContext != nil {
+				var body struct {
+					Context map[string][]string `json:"context"`
+				}
+				t.R.Nil(json.Unmarshal(res.Body.Bytes(), &body))
+				t.A.Equal(test.wantContext, body.Context)
+			}
+		})
+	}
+
+	tt.Run("outside HTTP", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		out, err := uc.Execute(context.Background(), dogSearch{ListQuery: ListQuery{Sort: Sort{{Field: "name"}}}})
+		t.R.Nil(err)
+		t.A.Equal(Sort{{Field: "name"}}, out.Sort)
+
+		_, err = uc.Execute(context.Background(), dogSearch{ListQuery: ListQuery{Sort: Sort{{Field: "weight"}}}})
+		var qe *QueryError
+		t.A.ErrorAs(err, &qe)
+	})
+
+	tt.Run("documented", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		spec, err := json.Marshal(s.OpenAPI)
+		t.R.Nil(err)
+
+		var doc struct {
+			Paths map[string]map[string]struct {
+				Parameters []struct {
+					Name   string `json:"name"`
+					In     string `json:"in"`
+					Schema struct {
+						Pattern string `json:"pattern"`
+					} `json:"schema"`
+				} `json:"parameters"`
+				Responses map[string]any `json:"responses"`
+			} `json:"paths"`
+		}
+		t.R.Nil(json.Unmarshal(spec, &doc))
+
+		op := doc.Paths["/dogs"]["get"]
+		params := map[string]string{}
+		for _, p := range op.Parameters {
+			params[p.Name] = p.Schema.Pattern
+		}
+		t.A.Contains(params, "filter[name][eq]")
+		t.A.Contains(params, "filter[name][contains]")
+		t.A.Contains(params, "filter[age][gt]")
+		t.A.Contains(params, "filter[age][lt]")
+		t.A.NotContains(params, "filter[age][eq]")
+		t.A.Equal("^[-+]?(name|age)(,[-+]?(name|age))*$", params["sort"])
+		t.A.Contains(op.Responses, "400")
+	})
+}
+
+type badDogSearch struct {
+	ListQuery `filter:"name:like" sort:"name"`
+}
+
+func TestAllowlistOf(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	allow, err := allowlistOf(reflect.TypeOf(&dogSearch{}))
+	t.R.Nil(err)
+	cached, err := allowlistOf(reflect.TypeOf(dogSearch{}))
+	t.R.Nil(err)
+	t.A.Equal(allow, cached)
+	_, ok := queryAllowlistCache.Load(reflect.TypeOf(dogSearch{}))
+	t.A.True(ok)
+	_, ok = queryAllowlistCache.Load(reflect.TypeOf(&dogSearch{}))
+	t.A.False(ok)
+
+	_, err = New(badDogSearch{}, &dogSearchResult{}, func(ctx context.Context, input badDogSearch, output *dogSearchResult) error {
+		return nil
+	}, nil, nil)
+	t.R.NotNil(err)
+	t.A.Contains(err.Error(), `badDogSearch.ListQuery: filter "name:like" has unknown operator "like"`)
+
+	t.A.NotNil(AnnotateListQuery(badDogSearch{})(nil))
+}
@@ -0,0 +1,197 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/muverum/usecase/api"
+	"github.com/muverum/usecase/node"
+	"github.com/swaggest/rest/web"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Manifest describes the route layout of an API, its entries referring to use cases and middleware
+// of a Registry by name
+type Manifest struct {
+	// Actions are the top level routes
+	Actions []Route `json:"actions" yaml:"actions"`
+	Nodes   []Node  `json:"nodes" yaml:"nodes"`
+}
+
+type Node struct {
+	Root       string   `json:"root" yaml:"root"`
+	Tags       []string `json:"tags" yaml:"tags"`
+	Visibility string   `json:"visibility" yaml:"visibility"`
+	// Middleware applies to every route of the node
+	Middleware []string `json:"middleware" yaml:"middleware"`
+	Routes     []Route  `json:"routes" yaml:"routes"`
+}
+
+type Route struct {
+	Path string `json:"path" yaml:"path"`
+	// Verbs maps http methods to use case names
+	Verbs map[string]string `json:"verbs" yaml:"verbs"`
+	// Middleware applies to every verb of the route
+	Middleware []string `json:"middleware" yaml:"middleware"`
+}
+
+var verbs = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Load reads a YAML or JSON manifest file
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// Parse reads a YAML or JSON manifest, rejecting keys it doesn't know
+func Parse(data []byte) (*Manifest, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	m := &Manifest{}
+	if err := decoder.Decode(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Bind resolves every name against the registry, reporting all the unknown names and invalid routes
+// together rather than one at a time
+func (m *Manifest) Bind(r *Registry, service *web.Service) (map[string]map[string]node.Handler, []*node.Node, error) {
+	var errs []error
+
+	middleware := func(location string, names []string) []func(next http.Handler) http.Handler {
+		var out []func(next http.Handler) http.Handler
+		for _, name := range names {
+			mw, ok := r.Middleware(name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown middleware %s", location, name))
+				continue
+			}
+			out = append(out, mw)
+		}
+		return out
+	}
+
+	routes := func(location string, routes []Route) map[string]map[string]node.Handler {
+		tree := map[string]map[string]node.Handler{}
+		for k, route := range routes {
+			at := fmt.Sprintf("%s[%d] %s", location, k, route.Path)
+			if !strings.HasPrefix(route.Path, "/") {
+				errs = append(errs, fmt.Errorf("%s: path must begin with /", at))
+				continue
+			}
+			if _, ok := tree[route.Path]; ok {
+				errs = append(errs, fmt.Errorf("%s: path is declared more than once", at))
+				continue
+			}
+			if len(route.Verbs) == 0 {
+				errs = append(errs, fmt.Errorf("%s: no verbs", at))
+				continue
+			}
+
+			mw := middleware(at, route.Middleware)
+			tree[route.Path] = map[string]node.Handler{}
+			for _, verb := range sortedKeys(route.Verbs) {
+				name := route.Verbs[verb]
+				method := strings.ToUpper(verb)
+				if !verbs[method] {
+					errs = append(errs, fmt.Errorf("%s: unknown verb %s", at, verb))
+					continue
+				}
+
+				h, ok := r.Handler(name)
+				if !ok {
+					errs = append(errs, fmt.Errorf("%s %s: unknown use case %s", at, method, name))
+					continue
+				}
+				tree[route.Path][method] = wrap(h, mw)
+			}
+		}
+		return tree
+	}
+
+	actions := routes("actions", m.Actions)
+
+	var nodes []*node.Node
+	roots := map[string]bool{}
+	for k, v := range m.Nodes {
+		at := fmt.Sprintf("nodes[%d] %s", k, v.Root)
+		if !strings.HasPrefix(v.Root, "/") {
+			errs = append(errs, fmt.Errorf("%s: root must begin with /", at))
+		}
+		if roots[v.Root] {
+			errs = append(errs, fmt.Errorf("%s: root is declared more than once", at))
+		}
+		roots[v.Root] = true
+
+		mw := middleware(at, v.Middleware)
+		tree := routes(at+" routes", v.Routes)
+
+		n := node.New(service, func(n *node.Node) {
+			n.Root = v.Root
+			n.Tags = v.Tags
+			n.Visibility = v.Visibility
+			n.Middleware = mw
+			n.Tree = map[node.Route]map[string]node.Handler{}
+			for path, verbs := range tree {
+				n.Tree[node.Route(path)] = verbs
+			}
+		})
+		nodes = append(nodes, n)
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	return actions, nodes, nil
+}
+
+// Apply binds the manifest and adds its actions and nodes to the API
+func (m *Manifest) Apply(r *Registry, a *api.API) error {
+	actions, nodes, err := m.Bind(r, a.Server)
+	if err != nil {
+		return err
+	}
+
+	if a.Actions == nil {
+		a.Actions = map[string]map[string]node.Handler{}
+	}
+	for path, v := range actions {
+		if _, ok := a.Actions[path]; ok {
+			return fmt.Errorf("action %s is already defined", path)
+		}
+		a.Actions[path] = v
+	}
+	a.Nodes = append(a.Nodes, nodes...)
+
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
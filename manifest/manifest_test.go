@@ -0,0 +1,201 @@
+package manifest
+
+import (
+	"encoding/json"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/api"
+	usecase2 "github.com/muverum/usecase/example/usecase"
+	log2 "github.com/muverum/usecase/log"
+	"github.com/muverum/usecase/node"
+	"github.com/muverum/usecase/rpc"
+	"github.com/swaggest/rest/web"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const routes = `
+actions:
+  - path: /cat
+    verbs: {POST: concatenate}
+    middleware: [stamp]
+nodes:
+  - root: /dog
+    tags: [dog]
+    middleware: [stamp]
+    routes:
+      - path: /walk/{place}/{times}
+        verbs: {get: walkDog}
+      - path: /feed
+        verbs: {POST: feedDog}
+`
+
+func stamp(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Stamp", "1")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func testRegistry(tt *testing.T) *Registry {
+	logger := log.New(os.Stdout, "EXAMPLE-", 0)
+	cat, err := usecase2.MakeCatUsecase()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	walk, err := usecase2.MakeDogWalkUseCase(logger, log2.NewLogWrapper(logger))
+	if err != nil {
+		tt.Fatal(err)
+	}
+	feed, err := usecase2.MakeDogFeedUseCase(log2.NewLogWrapper(logger))
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	r := NewRegistry()
+	for name, h := range map[string]node.Handler{"concatenate": cat, "walkDog": walk, "feedDog": feed} {
+		if err = r.Register(name, h); err != nil {
+			tt.Fatal(err)
+		}
+	}
+	if err = r.RegisterMiddleware("stamp", stamp); err != nil {
+		tt.Fatal(err)
+	}
+
+	return r
+}
+
+func TestManifest_Apply(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	path := filepath.Join(tt.TempDir(), "routes.yaml")
+	t.R.Nil(os.WriteFile(path, []byte(routes), 0o644))
+	m, err := Load(path)
+	t.R.Nil(err)
+
+	a := api.New(0, 0)
+	a.RPC = rpc.New()
+	t.R.Nil(m.Apply(testRegistry(tt), a))
+	t.R.Nil(a.MountRoutes())
+
+	server := httptest.NewServer(a.Server)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/cat", "application/json", strings.NewReader(`{"input":"banana"}`))
+	t.R.Nil(err)
+	_ = res.Body.Close()
+	t.A.Equal(http.StatusOK, res.StatusCode)
+	t.A.Equal("1", res.Header.Get("X-Stamp"))
+
+	res, err = http.Get(server.URL + "/dog/walk/atlanta/2")
+	t.R.Nil(err)
+	_ = res.Body.Close()
+	t.A.Equal(http.StatusOK, res.StatusCode)
+	t.A.Equal("1", res.Header.Get("X-Stamp"))
+
+	// Routes aren't exposed over RPC, which would skip their middleware, unless registered with it
+	t.A.False(a.RPC.Has("concatenateYourRequest"))
+
+	spec, err := json.Marshal(a.Server.OpenAPI)
+	t.R.Nil(err)
+	t.A.Contains(string(spec), `"/dog/feed"`)
+	t.A.Contains(string(spec), `"UsecaseConcatenateRequest"`)
+}
+
+func TestManifest_Bind(tt *testing.T) {
+	tests := []struct {
+		name          string
+		manifest      string
+		assertionFunc func(t *wrapt.T, err error)
+	}{
+		{
+			name:     "every unknown name is reported",
+			manifest: "actions:\n  - path: /cat\n    verbs: {POST: concatenat}\n    middleware: [auth]\nnodes:\n  - root: /dog\n    routes:\n      - path: /walk\n        verbs: {GET: walkCat}\n",
+			assertionFunc: func(t *wrapt.T, err error) {
+				t.R.NotNil(err)
+				t.A.Contains(err.Error(), "actions[0] /cat POST: unknown use case concatenat")
+				t.A.Contains(err.Error(), "actions[0] /cat: unknown middleware auth")
+				t.A.Contains(err.Error(), "nodes[0] /dog routes[0] /walk GET: unknown use case walkCat")
+			},
+		},
+		{
+			name:     "invalid routes",
+			manifest: "actions:\n  - path: cat\n    verbs: {POST: concatenate}\n  - path: /dog\n    verbs: {FETCH: walkDog}\n",
+			assertionFunc: func(t *wrapt.T, err error) {
+				t.R.NotNil(err)
+				t.A.Contains(err.Error(), "path must begin with /")
+				t.A.Contains(err.Error(), "unknown verb FETCH")
+			},
+		},
+		{
+			name:     "json manifests",
+			manifest: `{"actions": [{"path": "/cat", "verbs": {"POST": "concatenate"}}]}`,
+			assertionFunc: func(t *wrapt.T, err error) {
+				t.A.Nil(err)
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			m, err := Parse([]byte(test.manifest))
+			t.R.Nil(err)
+
+			_, _, err = m.Bind(testRegistry(tt), api.New(0, 0).Server)
+			test.assertionFunc(t, err)
+		})
+	}
+
+	tt.Run("unknown keys", func(tt *testing.T) {
+		_, err := Parse([]byte("nodes:\n  - roots: /dog\n"))
+		wrapt.WrapT(tt).A.NotNil(err)
+	})
+
+	tt.Run("duplicate registrations", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+		r := testRegistry(tt)
+		cat, err := usecase2.MakeCatUsecase()
+		t.R.Nil(err)
+		t.A.NotNil(r.Register("concatenate", cat))
+		t.A.NotNil(r.RegisterMiddleware("stamp", stamp))
+		t.A.Equal([]string{"concatenate", "feedDog", "walkDog"}, r.Names())
+	})
+}
+
+func TestWrap(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	cat, err := usecase2.MakeCatUsecase()
+	t.R.Nil(err)
+	breaker, err := usecase.NewCircuitBreaker("TestWrap")
+	t.R.Nil(err)
+	defer breaker.Close()
+
+	h := wrap(cat.Deprecate(usecase.Deprecation{Link: "/v2/cat"}).Breaker(breaker), []func(next http.Handler) http.Handler{stamp})
+
+	// Other transports would skip the route middleware, so the use case isn't offered to them
+	_, ok := h.(usecase.Interactor)
+	t.A.False(ok)
+	t.A.Equal("breaker TestWrap closed", h.(node.Described).Describe())
+
+	s := web.DefaultService()
+	n := node.New(s)
+	n.Root = "/pets"
+	n.Deprecation = &usecase.Deprecation{Link: "/v2/pets"}
+	n.Tree = map[node.Route]map[string]node.Handler{"/cat": {http.MethodPost: h}}
+	t.R.Nil(n.Mount())
+	t.A.Contains(n.Routes(), "[breaker TestWrap closed]")
+
+	res := httptest.NewRecorder()
+	s.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/pets/cat", strings.NewReader(`{"input":"banana"}`)))
+	t.R.Equal(http.StatusOK, res.Code, res.Body.String())
+	t.A.Equal("1", res.Header().Get("X-Stamp"))
+	t.A.Equal([]string{`</v2/cat>; rel="successor-version"`}, res.Header().Values("Link"))
+	t.A.Len(res.Header().Values("Deprecation"), 1)
+}
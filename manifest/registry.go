@@ -0,0 +1,129 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/node"
+	"github.com/swaggest/rest/nethttp"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Registry names the use cases (or any other node.Handler) and middleware a manifest can refer to
+type Registry struct {
+	mu         sync.RWMutex
+	handlers   map[string]node.Handler
+	middleware map[string]func(next http.Handler) http.Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers:   map[string]node.Handler{},
+		middleware: map[string]func(next http.Handler) http.Handler{},
+	}
+}
+
+func (r *Registry) Register(name string, h node.Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if name == "" || h == nil {
+		return fmt.Errorf("registering a use case requires a name and a handler")
+	}
+	if _, ok := r.handlers[name]; ok {
+		return fmt.Errorf("use case %s is already registered", name)
+	}
+	r.handlers[name] = h
+
+	return nil
+}
+
+func (r *Registry) RegisterMiddleware(name string, m func(next http.Handler) http.Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if name == "" || m == nil {
+		return fmt.Errorf("registering middleware requires a name and a func")
+	}
+	if _, ok := r.middleware[name]; ok {
+		return fmt.Errorf("middleware %s is already registered", name)
+	}
+	r.middleware[name] = m
+
+	return nil
+}
+
+func (r *Registry) Handler(name string) (node.Handler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	h, ok := r.handlers[name]
+	return h, ok
+}
+
+func (r *Registry) Middleware(name string) (func(next http.Handler) http.Handler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.middleware[name]
+	return m, ok
+}
+
+// Names lists the registered use cases, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.handlers))
+	for k := range r.handlers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// wrapped applies route middleware to a handler, keeping it discoverable by swaggest. It doesn't expose the
+// use case's Interactor, which other transports would call without the middleware.
+type wrapped struct {
+	handler    node.Handler
+	middleware []func(next http.Handler) http.Handler
+}
+
+func (w wrapped) Handler() http.Handler {
+	return nethttp.WrapHandler(w.handler.Handler(), w.middleware...)
+}
+
+// Deprecation is the use case's own, so that a deprecated node doesn't add its headers to the use case's
+func (w wrapped) Deprecation() *usecase.Deprecation {
+	if d, ok := w.handler.(interface{ Deprecation() *usecase.Deprecation }); ok {
+		return d.Deprecation()
+	}
+
+	return nil
+}
+
+func (w wrapped) Describe() string {
+	if d, ok := w.handler.(node.Described); ok {
+		return d.Describe()
+	}
+
+	return ""
+}
+
+func (w wrapped) Transport() string {
+	if t, ok := w.handler.(node.Transport); ok {
+		return t.Transport()
+	}
+
+	return ""
+}
+
+func wrap(h node.Handler, middleware []func(next http.Handler) http.Handler) node.Handler {
+	if len(middleware) == 0 {
+		return h
+	}
+
+	return wrapped{handler: h, middleware: middleware}
+}
@@ -3,6 +3,8 @@ package node
 import (
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/audit"
 	"github.com/swaggest/openapi-go/openapi3"
 	"github.com/swaggest/rest/nethttp"
 	"github.com/swaggest/rest/web"
@@ -16,6 +18,18 @@ type Handler interface {
 	Handler() http.Handler
 }
 
+// Transport is implemented by handlers which don't speak plain request/response HTTP (websockets, etc)
+// so that the transport can be called out in Routes()
+type Transport interface {
+	Transport() string
+}
+
+// Described is implemented by handlers with runtime policies worth showing in Routes(), such as the
+// state of a use case's circuit breaker
+type Described interface {
+	Describe() string
+}
+
 type Node struct {
 	//Root is the mountpoint for this node
 	Root           string
@@ -23,8 +37,19 @@ type Node struct {
 	service        *web.Service
 	Middleware     []func(next http.Handler) http.Handler
 	DefaultOptions Handler
+	// Deprecation when set marks every route of the node as deprecated
+	Deprecation *usecase.Deprecation
+	// Visibility is the audience of the node's routes for filtered OpenAPI documents, use cases
+	// with a visibility of their own keep it
+	Visibility string
+	// Audit when set records the invocations of the node's mutating routes, use cases with a sink of
+	// their own keep it
+	Audit audit.Sink
 	// Tree reads as routePath -> map of http verb to its usecase
 	Tree map[Route]map[string]Handler
+	// Versions holds per-version overrides of Tree keyed by version (v1, v2). When the node is mounted
+	// for a version its routes and verbs replace or extend those of Tree, and a nil Handler removes the verb.
+	Versions map[string]map[Route]map[string]Handler
 }
 
 func New(server *web.Service, options ...func(n *Node)) *Node {
@@ -49,8 +74,15 @@ func (a *Node) Routes() string {
 	sb.WriteString(a.Root)
 	sb.WriteString("\n")
 	for route, v := range a.Tree {
-		for verb, _ := range v {
-			sb.WriteString(fmt.Sprintf("\t%s\t%s\n", route, verb))
+		for verb, h := range v {
+			line := fmt.Sprintf("\t%s\t%s", route, verb)
+			if t, ok := h.(Transport); ok && t.Transport() != "" {
+				line += fmt.Sprintf("\t(%s)", t.Transport())
+			}
+			if d, ok := h.(Described); ok && d.Describe() != "" {
+				line += fmt.Sprintf("\t[%s]", d.Describe())
+			}
+			sb.WriteString(line + "\n")
 		}
 	}
 
@@ -58,48 +90,116 @@ func (a *Node) Routes() string {
 }
 
 func (a *Node) Validate() error {
+	return validate(a.Tree)
+}
 
-	for route, _ := range a.Tree {
+func validate(tree map[Route]map[string]Handler) error {
+	for route, _ := range tree {
 		//Error if not prefixed by /
 		if !strings.HasPrefix(string(route), "/") {
-			return fmt.Errorf("")
+			return fmt.Errorf("route %s must begin with /", route)
 		}
 	}
 
 	return nil
 }
 
+// VersionTree returns the Tree with the overrides for version applied
+func (a *Node) VersionTree(version string) map[Route]map[string]Handler {
+	tree := make(map[Route]map[string]Handler, len(a.Tree))
+	for route, v := range a.Tree {
+		tree[route] = make(map[string]Handler, len(v))
+		for verb, h := range v {
+			tree[route][verb] = h
+		}
+	}
+
+	for route, v := range a.Versions[version] {
+		if tree[route] == nil {
+			tree[route] = map[string]Handler{}
+		}
+		for verb, h := range v {
+			if h == nil {
+				delete(tree[route], verb)
+				continue
+			}
+			tree[route][verb] = h
+		}
+		if len(tree[route]) == 0 {
+			delete(tree, route)
+		}
+	}
+
+	return tree
+}
+
 func (a *Node) Mount() error {
+	return a.mount(a.service, a.Root, a.Tree)
+}
+
+// MountVersion mounts the node onto the service of a version under /<version><Root>, using the
+// VersionTree for that version
+func (a *Node) MountVersion(service *web.Service, version string) error {
+	return a.mount(service, "/"+version+a.Root, a.VersionTree(version))
+}
+
+// handler wraps a route in the node's deprecation, after routing so that calls are counted under the full
+// route pattern. Use cases deprecated themselves keep their own, sending a single set of headers.
+func (a *Node) handler(h Handler) http.Handler {
+	if a.Deprecation == nil {
+		return h.Handler()
+	}
+	if d, ok := h.(interface{ Deprecation() *usecase.Deprecation }); ok && d.Deprecation() != nil {
+		return h.Handler()
+	}
+
+	return nethttp.WrapHandler(h.Handler(), a.Deprecation.Middleware)
+}
+
+func (a *Node) mount(service *web.Service, root string, tree map[Route]map[string]Handler) error {
 	var err error
-	if err = a.Validate(); err != nil {
+	if err = validate(tree); err != nil {
 		return err
 	}
-	a.service.Route(a.Root, func(r chi.Router) {
+	service.Route(root, func(r chi.Router) {
 		//Define the middleware for this node if present
 		if len(a.Middleware) > 0 {
 			r.Use(a.Middleware...)
 		}
 
+		if a.Audit != nil {
+			r.Use(audit.Middleware(a.Audit))
+		}
+
 		// Make sure the collector is wrapped accordingly
-		if len(a.Tags) > 0 {
-			r.Use(nethttp.AnnotateOpenAPI(a.service.OpenAPICollector, func(op *openapi3.Operation) error {
-				op.Tags = a.Tags
+		if len(a.Tags) > 0 || a.Deprecation != nil || a.Visibility != "" {
+			r.Use(nethttp.AnnotateOpenAPI(service.OpenAPICollector, func(op *openapi3.Operation) error {
+				if len(a.Tags) > 0 {
+					op.Tags = a.Tags
+				}
+				if a.Deprecation != nil {
+					deprecated := true
+					op.Deprecated = &deprecated
+				}
+				if _, ok := op.MapOfAnything[usecase.VisibilityExtension]; !ok && a.Visibility != "" {
+					op.WithMapOfAnythingItem(usecase.VisibilityExtension, a.Visibility)
+				}
 				return nil
 			}))
 		}
 
-		for route, v := range a.Tree {
+		for route, v := range tree {
 			for verb, action := range v {
 				switch verb {
 				case http.MethodOptions:
 					//apply the explicit options
-					r.Method(verb, string(route), action.Handler())
+					r.Method(verb, string(route), a.handler(action))
 				default:
 					// apply Default if present
 					if a.DefaultOptions != nil {
-						r.Method(verb, string(route), a.DefaultOptions.Handler())
+						r.Method(verb, string(route), a.handler(a.DefaultOptions))
 					}
-					r.Method(verb, string(route), action.Handler())
+					r.Method(verb, string(route), a.handler(action))
 				}
 			}
 		}
@@ -2,10 +2,15 @@ package node
 
 import (
 	"context"
+	"encoding/json"
+	"expvar"
 	"github.com/metrumresearchgroup/wrapt"
 	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/audit"
 	"github.com/swaggest/rest/web"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -83,6 +88,11 @@ func ptr[I any](input I) *I {
 
 func TestNode_Routes(tt *testing.T) {
 	uc1, _ := usecase.New[string, *string]("", ptr(""), func(ctx context.Context, input string, output *string) error { return nil }, nil, nil)
+	breaker, err := usecase.NewCircuitBreaker("TestNode_Routes")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer breaker.Close()
 
 	type fields struct {
 		Root           string
@@ -123,6 +133,25 @@ func TestNode_Routes(tt *testing.T) {
 				},
 			},
 		},
+		{
+			name: "resilience policies",
+			assertionFunc: func(t *wrapt.T, out string) {
+				t.A.Contains(out, "\t/flaky\tGET\t[breaker TestNode_Routes closed, retry x4]\n")
+				t.A.Contains(out, "\t/steady\tGET\n")
+			},
+			fields: fields{
+				Root:    "/resilient",
+				service: web.DefaultService(),
+				Tree: map[Route]map[string]Handler{
+					"/flaky": {
+						http.MethodGet: uc1.Retry(usecase.RetryPolicy{MaxAttempts: 4}).Breaker(breaker),
+					},
+					"/steady": {
+						http.MethodGet: uc1,
+					},
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		tt.Run(test.name, func(tt *testing.T) {
@@ -144,3 +173,82 @@ func TestNode_Routes(tt *testing.T) {
 		})
 	}
 }
+
+func TestNode_Deprecation(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	uc, _ := usecase.New[string, *string]("", ptr(""), func(ctx context.Context, input string, output *string) error { return nil }, nil, nil)
+
+	s := web.DefaultService()
+	n := New(s, func(n *Node) {
+		n.Root = "/old"
+		n.Deprecation = &usecase.Deprecation{Link: "/new"}
+		n.Tree = map[Route]map[string]Handler{
+			"/thing": {http.MethodGet: uc},
+			"/other": {http.MethodGet: uc.Deprecate(usecase.Deprecation{Link: "/newer"})},
+		}
+	})
+	t.R.Nil(n.Mount())
+
+	calls := func(route string) int64 {
+		if v, ok := usecase.DeprecatedCalls.Get(route).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := calls("GET /old/thing")
+
+	res := httptest.NewRecorder()
+	s.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/old/thing", nil))
+	t.A.Equal("true", res.Header().Get("Deprecation"))
+	t.A.Equal([]string{`</new>; rel="successor-version"`}, res.Header().Values("Link"))
+	t.A.Equal(before+1, calls("GET /old/thing"))
+	t.A.Zero(calls("GET /old/*"))
+
+	// The use case's own deprecation is the only one applied
+	before = calls("GET /old/other")
+	res = httptest.NewRecorder()
+	s.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/old/other", nil))
+	t.A.Equal([]string{`</newer>; rel="successor-version"`}, res.Header().Values("Link"))
+	t.A.Equal(before+1, calls("GET /old/other"))
+
+	spec, err := json.Marshal(s.OpenAPI)
+	t.R.Nil(err)
+	t.A.Contains(string(spec), `"deprecated":true`)
+}
+
+func TestNode_Audit(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	uc, _ := usecase.New[string, *string]("", ptr(""), func(ctx context.Context, input string, output *string) error { return nil }, nil, nil)
+
+	nodeSink, ownSink := &audit.Memory{}, &audit.Memory{}
+	s := web.DefaultService()
+	n := New(s, func(n *Node) {
+		n.Root = "/dogs"
+		n.Audit = nodeSink
+		n.Tree = map[Route]map[string]Handler{
+			"/":        {http.MethodGet: uc, http.MethodPost: uc},
+			"/all":     {http.MethodDelete: uc},
+			"/reports": {http.MethodGet: uc.Audit(ownSink)},
+		}
+	})
+	t.R.Nil(n.Mount())
+
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, "/dogs/"},
+		{http.MethodPost, "/dogs/"},
+		{http.MethodDelete, "/dogs/all"},
+		{http.MethodGet, "/dogs/reports"},
+	} {
+		res := httptest.NewRecorder()
+		s.ServeHTTP(res, httptest.NewRequest(r.method, r.path, strings.NewReader(`""`)))
+		t.R.Equal(http.StatusOK, res.Code, res.Body.String())
+	}
+
+	var routes []string
+	for _, r := range nodeSink.Records() {
+		routes = append(routes, r.Route)
+	}
+	t.A.Equal([]string{"POST /dogs", "DELETE /dogs/all"}, routes)
+	t.R.Len(ownSink.Records(), 1)
+	t.A.Equal("GET /dogs/reports", ownSink.Records()[0].Route)
+}
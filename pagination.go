@@ -0,0 +1,288 @@
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/swaggest/rest"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by DecodeCursor for a cursor which wasn't signed with the key or is malformed
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a page, handed to clients as an opaque signed string which they can't forge
+type Cursor struct {
+	// Offset is the number of items before the page
+	Offset int `json:"o,omitempty"`
+	// After and Before are the sort keys of the items the page starts after or ends before, for keyset
+	// pagination
+	After  string `json:"a,omitempty"`
+	Before string `json:"b,omitempty"`
+}
+
+// EncodeCursor signs the cursor with the key
+func EncodeCursor(key []byte, c Cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// DecodeCursor checks the signature of a cursor from EncodeCursor and reads it
+func DecodeCursor(key []byte, s string) (Cursor, error) {
+	var c Cursor
+
+	encoded, signature, ok := strings.Cut(s, ".")
+	if !ok {
+		return c, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// Pagination configures how a use case reads PageRequest and signs the cursors of its Page
+type Pagination struct {
+	// Key signs the cursors. When empty a key is generated for the process, so cursors are only good for
+	// the instance which handed them out until it restarts.
+	Key []byte
+	// DefaultLimit is the page size when the request gives none, defaults to 20
+	DefaultLimit int
+	// MaxLimit caps the page size a request can ask for, defaults to 100
+	MaxLimit int
+}
+
+var processCursorKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func (p *Pagination) key() []byte {
+	if p != nil && len(p.Key) > 0 {
+		return p.Key
+	}
+
+	return processCursorKey
+}
+
+func (p *Pagination) limits() (def, most int) {
+	def, most = 20, 100
+	if p != nil && p.MaxLimit > 0 {
+		most = p.MaxLimit
+	}
+	if p != nil && p.DefaultLimit > 0 {
+		def = p.DefaultLimit
+	}
+
+	return min(def, most), most
+}
+
+// Paginate returns a copy of the use case reading its PageRequest and signing the cursors of its Page
+// as configured rather than with the defaults
+func (i UseCase[I, O]) Paginate(p Pagination) UseCase[I, O] {
+	i.pagination = &p
+	return i
+}
+
+// PageRequest is embedded in the input of a paginated use case. A page is fetched by the cursor of a
+// previous one, or failing that by offset, and the use case reads where it starts from Position and
+// how many items it holds from PageSize.
+type PageRequest struct {
+	Limit  int    `query:"limit" minimum:"0" description:"Number of items in the page, capped by the operation's maximum."`
+	Cursor string `query:"cursor" description:"Opaque cursor of the page to fetch, from the next or prev of another page."`
+	Offset int    `query:"offset" minimum:"0" description:"Number of items to skip when there is no cursor."`
+
+	size     int
+	position Cursor
+}
+
+// PageSize is the number of items the page should hold, within the use case's bounds
+func (p PageRequest) PageSize() int {
+	if p.size == 0 {
+		def, _ := (*Pagination)(nil).limits()
+		return def
+	}
+
+	return p.size
+}
+
+// Position is where the page starts, from the cursor or the offset
+func (p PageRequest) Position() Cursor {
+	return p.position
+}
+
+func (p *PageRequest) pageRequest() *PageRequest {
+	return p
+}
+
+type pageRequester interface {
+	pageRequest() *PageRequest
+}
+
+// resolve reads the cursor and bounds the limit, reporting a cursor which can't be trusted as an invalid field
+func (p *PageRequest) resolve(pagination *Pagination) error {
+	def, most := pagination.limits()
+	switch {
+	case p.Limit <= 0:
+		p.size = def
+	case p.Limit > most:
+		p.size = most
+	default:
+		p.size = p.Limit
+	}
+
+	if p.Cursor == "" {
+		p.position = Cursor{}
+		if p.Offset > 0 {
+			p.position.Offset = p.Offset
+		}
+		return nil
+	}
+
+	c, err := DecodeCursor(pagination.key(), p.Cursor)
+	if err != nil {
+		return &ValidationError{Errors: rest.ValidationErrors{"query:cursor": {err.Error()}}}
+	}
+	p.position = c
+
+	return nil
+}
+
+// Page is the output of a paginated use case, or is embedded in it. The use case sets the items and
+// the cursors of the pages either side, which are signed into next and prev and linked from the Link
+// header.
+type Page[T any] struct {
+	Items []T `json:"items" required:"true"`
+	// Total is the number of items across the pages, when the use case knows it
+	Total *int   `json:"total,omitempty"`
+	Next  string `json:"next,omitempty" description:"Cursor of the next page, absent on the last."`
+	Prev  string `json:"prev,omitempty" description:"Cursor of the previous page, absent on the first."`
+	Link  string `header:"Link" json:"-" description:"Links to the next and previous pages, as in RFC 8288."`
+
+	next, prev *Cursor
+}
+
+// SetNext gives the position of the next page, leaving it unset on the last page
+func (p *Page[T]) SetNext(c Cursor) {
+	p.next = &c
+}
+
+// SetPrev gives the position of the previous page, leaving it unset on the first page
+func (p *Page[T]) SetPrev(c Cursor) {
+	p.prev = &c
+}
+
+// Offsets sets the pages either side by offset, where more tells whether there are items after this page
+func (p *Page[T]) Offsets(req PageRequest, more bool) {
+	offset, size := req.Position().Offset, req.PageSize()
+	if more {
+		p.SetNext(Cursor{Offset: offset + size})
+	}
+	if offset > 0 {
+		p.SetPrev(Cursor{Offset: max(offset-size, 0)})
+	}
+}
+
+type pageFinisher interface {
+	finish(key []byte, r *http.Request) error
+}
+
+// finish signs the cursors and, when there is a request to link from, sets the Link header
+func (p *Page[T]) finish(key []byte, r *http.Request) error {
+	if p.Items == nil {
+		p.Items = []T{}
+	}
+
+	var links []string
+	for _, v := range []struct {
+		rel    string
+		cursor *Cursor
+		into   *string
+	}{{"next", p.next, &p.Next}, {"prev", p.prev, &p.Prev}} {
+		if v.cursor == nil {
+			continue
+		}
+
+		s, err := EncodeCursor(key, *v.cursor)
+		if err != nil {
+			return err
+		}
+		*v.into = s
+
+		if r != nil {
+			u := *r.URL
+			q := u.Query()
+			q.Set("cursor", s)
+			q.Del("offset")
+			u.RawQuery = q.Encode()
+			links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), v.rel))
+		}
+	}
+	p.Link = strings.Join(links, ", ")
+
+	return nil
+}
+
+func (i UseCase[I, O]) paginates() bool {
+	_, ok := any(i.output).(pageFinisher)
+	return ok
+}
+
+func (i UseCase[I, O]) pageRequested() bool {
+	var in I
+	_, ok := any(&in).(pageRequester)
+	return ok
+}
+
+// pageRequest resolves the page request of an input before it is validated
+func (i UseCase[I, O]) pageRequest(input *I) error {
+	p, ok := any(input).(pageRequester)
+	if !ok {
+		return nil
+	}
+
+	return p.pageRequest().resolve(i.pagination)
+}
+
+// finishPage signs the cursors of an output's page once the use case has set them
+func (i UseCase[I, O]) finishPage(ctx context.Context, output O) error {
+	p, ok := any(output).(pageFinisher)
+	if !ok {
+		return nil
+	}
+
+	r, _ := ctx.Value(requestKey{}).(*http.Request)
+	return p.finish(i.pagination.key(), r)
+}
@@ -0,0 +1,188 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/swaggest/rest/web"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCursor(tt *testing.T) {
+	key := []byte("kennel")
+	signed, err := EncodeCursor(key, Cursor{Offset: 40, After: "rex"})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	other, err := EncodeCursor(key, Cursor{Offset: 400})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	payload, _, _ := strings.Cut(other, ".")
+	_, signature, _ := strings.Cut(signed, ".")
+
+	tests := []struct {
+		name    string
+		key     []byte
+		cursor  string
+		want    Cursor
+		wantErr error
+	}{
+		{name: "round trip", key: key, cursor: signed, want: Cursor{Offset: 40, After: "rex"}},
+		{name: "other key", key: []byte("shelter"), cursor: signed, wantErr: ErrInvalidCursor},
+		{name: "tampered", key: key, cursor: payload + "." + signature, wantErr: ErrInvalidCursor},
+		{name: "unsigned", key: key, cursor: "eyJvIjo0MH0", wantErr: ErrInvalidCursor},
+		{name: "garbage", key: key, cursor: "not a cursor.!!", wantErr: ErrInvalidCursor},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			got, err := DecodeCursor(test.key, test.cursor)
+			t.A.Equal(test.wantErr, err)
+			t.A.Equal(test.want, got)
+		})
+	}
+}
+
+type dogList struct {
+	PageRequest
+	Breed string `query:"breed"`
+}
+
+type listedDog struct {
+	Name string `json:"name"`
+}
+
+func TestUseCase_Paginate(tt *testing.T) {
+	var dogs []listedDog
+	for k := 0; k < 7; k++ {
+		dogs = append(dogs, listedDog{Name: fmt.Sprintf("dog%d", k)})
+	}
+
+	uc, err := New(dogList{}, &Page[listedDog]{}, func(ctx context.Context, input dogList, output *Page[listedDog]) error {
+		from := min(input.Position().Offset, len(dogs))
+		to := min(from+input.PageSize(), len(dogs))
+		output.Items = dogs[from:to]
+		total := len(dogs)
+		output.Total = &total
+		output.Offsets(input.PageRequest, to < len(dogs))
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	s := web.DefaultService()
+	s.Method(http.MethodGet, "/dogs", uc.Paginate(Pagination{Key: []byte("kennel"), DefaultLimit: 3, MaxLimit: 5}).Handler())
+
+	type page struct {
+		Items []listedDog `json:"items"`
+		Total int         `json:"total"`
+		Next  string      `json:"next"`
+		Prev  string      `json:"prev"`
+	}
+	get := func(t *wrapt.T, path string) (page, *httptest.ResponseRecorder) {
+		res := httptest.NewRecorder()
+		s.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var p page
+		if res.Code == http.StatusOK {
+			t.R.Nil(json.Unmarshal(res.Body.Bytes(), &p))
+		}
+		return p, res
+	}
+
+	tt.Run("follows cursors", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		first, res := get(t, "/dogs?breed=collie")
+		t.R.Equal(http.StatusOK, res.Code, res.Body.String())
+		t.A.Equal(dogs[0:3], first.Items)
+		t.A.Equal(7, first.Total)
+		t.A.Empty(first.Prev)
+		t.R.NotEmpty(first.Next)
+		t.A.Equal(fmt.Sprintf(`</dogs?breed=collie&cursor=%s>; rel="next"`, first.Next), res.Header().Get("Link"))
+
+		second, res := get(t, "/dogs?breed=collie&cursor="+first.Next)
+		t.R.Equal(http.StatusOK, res.Code, res.Body.String())
+		t.A.Equal(dogs[3:6], second.Items)
+		t.A.Equal(fmt.Sprintf(`</dogs?breed=collie&cursor=%s>; rel="next", </dogs?breed=collie&cursor=%s>; rel="prev"`, second.Next, second.Prev), res.Header().Get("Link"))
+
+		last, _ := get(t, "/dogs?cursor="+second.Next)
+		t.A.Equal(dogs[6:], last.Items)
+		t.A.Empty(last.Next)
+
+		back, _ := get(t, "/dogs?cursor="+second.Prev)
+		t.A.Equal(first.Items, back.Items)
+	})
+
+	tests := []struct {
+		name      string
+		path      string
+		wantCode  int
+		wantItems []listedDog
+	}{
+		{name: "offset", path: "/dogs?offset=5", wantCode: http.StatusOK, wantItems: dogs[5:]},
+		{name: "limit", path: "/dogs?limit=1", wantCode: http.StatusOK, wantItems: dogs[0:1]},
+		{name: "limit capped", path: "/dogs?limit=50", wantCode: http.StatusOK, wantItems: dogs[0:5]},
+		{name: "past the end", path: "/dogs?offset=50", wantCode: http.StatusOK, wantItems: []listedDog{}},
+		{name: "forged cursor", path: "/dogs?cursor=eyJvIjoyfQ.c2lnbmF0dXJl", wantCode: http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			got, res := get(t, test.path)
+			t.R.Equal(test.wantCode, res.Code, res.Body.String())
+			if test.wantItems != nil {
+				t.A.Equal(test.wantItems, got.Items)
+			}
+			if got.Next == "" && got.Prev == "" {
+				t.A.NotContains(res.Header(), "Link")
+			}
+		})
+	}
+
+	tt.Run("outside HTTP", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		out, err := uc.Execute(context.Background(), dogList{PageRequest: PageRequest{Limit: 2}})
+		t.R.Nil(err)
+		t.A.Equal(dogs[0:2], out.Items)
+		t.A.NotEmpty(out.Next)
+		t.A.Empty(out.Link)
+	})
+
+	tt.Run("documented", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+
+		spec, err := json.Marshal(s.OpenAPI)
+		t.R.Nil(err)
+
+		var doc struct {
+			Paths map[string]map[string]struct {
+				Parameters []struct {
+					Name string `json:"name"`
+				} `json:"parameters"`
+				Responses map[string]struct {
+					Headers map[string]any `json:"headers"`
+				} `json:"responses"`
+			} `json:"paths"`
+		}
+		t.R.Nil(json.Unmarshal(spec, &doc))
+
+		op := doc.Paths["/dogs"]["get"]
+		var params []string
+		for _, p := range op.Parameters {
+			params = append(params, p.Name)
+		}
+		t.A.ElementsMatch([]string{"limit", "cursor", "offset", "breed"}, params)
+		t.A.Contains(op.Responses["200"].Headers, "Link")
+		t.A.Contains(op.Responses, "422")
+	})
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"github.com/muverum/usecase/redact"
+	"github.com/swaggest/usecase/status"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+)
+
+// StageUseCase is the Stage of a PanicError raised by the UseCaseFunc itself
+const StageUseCase = "use case"
+
+// PanicError replaces a panic in the use case or one of its middleware. Its message is deliberately
+// generic so that nothing about the panic reaches clients, the details being in its fields and in the
+// use case log.
+type PanicError struct {
+	// Stage is StageUseCase or middleware[index] followed by the name of the middleware func
+	Stage string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return "internal error"
+}
+
+// Status maps the error to a 500 response
+func (e *PanicError) Status() status.Code {
+	return status.Internal
+}
+
+// Detail describes the panic for logs
+func (e *PanicError) Detail() string {
+	return fmt.Sprintf("panic in %s: %v", e.Stage, e.Value)
+}
+
+// recovered calls a stage of the chain, turning a panic into a PanicError
+func recovered(stage func() string, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Stage: stage(), Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
+
+func middlewareStage(index int, m any) func() string {
+	return func() string {
+		return fmt.Sprintf("middleware[%d] %s", index, funcName(m))
+	}
+}
+
+func funcName(fn any) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+
+	return "unknown"
+}
+
+// log writes an error to the use case logger, panics with their stage and stack, with the redacted values
+// of the input scrubbed from it
+func (i UseCase[I, O]) log(err error, input any) {
+	if i.logger == nil {
+		return
+	}
+
+	var p *PanicError
+	if errors.As(err, &p) {
+		i.logger.Log(redact.Scrub(fmt.Sprintf("%s\n%s", p.Detail(), p.Stack), input))
+		return
+	}
+
+	i.logger.Log(redact.Scrub(err.Error(), input))
+}
@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase/audit"
+	"github.com/swaggest/rest/web"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Log(args ...any) {
+	l.lines = append(l.lines, fmt.Sprint(args...))
+}
+
+func TestUseCase_panics(tt *testing.T) {
+	type Input struct {
+		Name string `query:"name"`
+	}
+
+	type Output struct {
+		Greeting string `json:"greeting"`
+	}
+
+	pass := func(ctx context.Context, input Input, output *Output) (context.Context, error) {
+		return ctx, nil
+	}
+	explode := func(ctx context.Context, input Input, output *Output) (context.Context, error) {
+		panic("middleware secret")
+	}
+
+	tests := []struct {
+		name          string
+		usecase       UseCaseFunc[Input, *Output]
+		middleware    []Middleware[Input, *Output]
+		assertionFunc func(t *wrapt.T, p *PanicError, logged string)
+	}{
+		{
+			name: "use case",
+			usecase: func(ctx context.Context, input Input, output *Output) error {
+				var m map[string]int
+				m["boom"]++
+				return nil
+			},
+			middleware: []Middleware[Input, *Output]{pass},
+			assertionFunc: func(t *wrapt.T, p *PanicError, logged string) {
+				t.A.Equal(StageUseCase, p.Stage)
+				t.A.Contains(logged, "panic in use case: assignment to entry in nil map")
+			},
+		},
+		{
+			name: "middleware",
+			usecase: func(ctx context.Context, input Input, output *Output) error {
+				return nil
+			},
+			middleware: []Middleware[Input, *Output]{pass, explode},
+			assertionFunc: func(t *wrapt.T, p *PanicError, logged string) {
+				t.A.True(strings.HasPrefix(p.Stage, "middleware[1] "), p.Stage)
+				t.A.Equal("middleware secret", p.Value)
+				t.A.Contains(logged, "middleware secret")
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			logger := &recordingLogger{}
+			uc, err := New(Input{}, &Output{}, test.usecase, nil, logger, test.middleware...)
+			t.R.Nil(err)
+
+			// Outside of HTTP the panic comes back as an error
+			_, err = uc.Execute(context.Background(), Input{Name: "bob"})
+			var p *PanicError
+			t.R.True(errors.As(err, &p))
+			t.A.NotEmpty(p.Stack)
+			t.R.Len(logger.lines, 1)
+			t.A.Contains(logger.lines[0], "goroutine")
+			test.assertionFunc(t, p, logger.lines[0])
+
+			// Through HTTP it is a 500 which doesn't give anything away
+			s := web.DefaultService()
+			s.Method(http.MethodGet, "/greet", uc.Handler())
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/greet?name=bob", nil))
+			t.A.Equal(http.StatusInternalServerError, res.Code)
+			t.A.NotContains(res.Body.String(), "secret")
+			t.A.NotContains(res.Body.String(), "nil map")
+		})
+	}
+}
+
+func TestUseCase_logScrubsSecrets(tt *testing.T) {
+	tests := []struct {
+		name    string
+		usecase func(ctx context.Context, input adoption, output *adopted) error
+	}{
+		{
+			name: "error",
+			usecase: func(ctx context.Context, input adoption, output *adopted) error {
+				return fmt.Errorf("wrong password %q for %s", input.Password, input.Adopter)
+			},
+		},
+		{
+			name: "panic",
+			usecase: func(ctx context.Context, input adoption, output *adopted) error {
+				panic("wrong password " + input.Password)
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			logger := &recordingLogger{}
+			uc, err := New(adoption{}, &adopted{}, test.usecase, nil, logger)
+			t.R.Nil(err)
+
+			sink := &audit.Memory{}
+			_, err = uc.Audit(sink).Execute(context.Background(), adoption{Adopter: "sam", Password: "hunter2"})
+			t.R.NotNil(err)
+
+			t.R.Len(logger.lines, 1)
+			t.A.Contains(logger.lines[0], "wrong password")
+			t.A.Contains(logger.lines[0], "[REDACTED]")
+			t.A.NotContains(logger.lines[0], "hunter2")
+
+			t.R.Len(sink.Records(), 1)
+			t.A.NotContains(sink.Records()[0].Error, "hunter2")
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package usecase
+
+import (
+	"net/http"
+)
+
+// MediaTyped is implemented by the handler of a use case restricted to some media types, for the API's
+// content negotiation to find
+type MediaTyped interface {
+	MediaTypes() []string
+}
+
+// Produces returns a copy of the use case whose output is only encoded as the media types, in order
+// of preference, rather than as any the API has an encoder for
+func (i UseCase[I, O]) Produces(mediaTypes ...string) UseCase[I, O] {
+	i.produces = mediaTypes
+	return i
+}
+
+type producing struct {
+	http.Handler
+	mediaTypes []string
+}
+
+func (p producing) MediaTypes() []string {
+	return p.mediaTypes
+}
+
+func (i UseCase[I, O]) producesMiddleware(next http.Handler) http.Handler {
+	return producing{Handler: next, mediaTypes: i.produces}
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Channel is an in-memory Source and Sink backed by a buffered channel
+type Channel struct {
+	messages chan *channelMessage
+	once     sync.Once
+	closed   chan struct{}
+}
+
+func NewChannel(size int) *Channel {
+	return &Channel{
+		messages: make(chan *channelMessage, size),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (c *Channel) Publish(ctx context.Context, body []byte) error {
+	return c.enqueue(ctx, &channelMessage{body: body, attempt: 1, channel: c})
+}
+
+func (c *Channel) enqueue(ctx context.Context, m *channelMessage) error {
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case c.messages <- m:
+		return nil
+	case <-c.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Channel) Receive(ctx context.Context) (Message, error) {
+	select {
+	case m := <-c.messages:
+		return m, nil
+	default:
+	}
+
+	select {
+	case m := <-c.messages:
+		return m, nil
+	case <-c.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Len is the number of messages waiting to be received
+func (c *Channel) Len() int {
+	return len(c.messages)
+}
+
+// Close stops further publishing. Receive keeps returning queued messages until it is drained.
+func (c *Channel) Close() {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+}
+
+type channelMessage struct {
+	body    []byte
+	attempt int
+	channel *Channel
+}
+
+func (m *channelMessage) Body() []byte {
+	return m.body
+}
+
+func (m *channelMessage) Attempt() int {
+	return m.attempt
+}
+
+func (m *channelMessage) Ack() error {
+	return nil
+}
+
+// Nack requeues the message even after Close so that in-flight retries aren't lost while draining, a
+// Consumer waiting for its handlers before it stops receiving
+func (m *channelMessage) Nack() error {
+	select {
+	case m.channel.messages <- &channelMessage{body: m.body, attempt: m.attempt + 1, channel: m.channel}:
+		return nil
+	default:
+		return errors.New("channel is full, message could not be requeued")
+	}
+}
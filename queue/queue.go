@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/log"
+	"github.com/muverum/usecase/redact"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by a Source once it has been closed and drained
+var ErrClosed = errors.New("source closed")
+
+// Message is a single delivery from a Source
+type Message interface {
+	Body() []byte
+	// Attempt is the 1 based number of times this message has been delivered
+	Attempt() int
+	// Ack removes the message from the source
+	Ack() error
+	// Nack returns the message to the source for redelivery
+	Nack() error
+}
+
+// Source delivers messages, Receive blocks until one is available, the context is done or the source is closed
+type Source interface {
+	Receive(ctx context.Context) (Message, error)
+}
+
+// Sink accepts message bodies, it is used to dead-letter messages which can't be processed
+type Sink interface {
+	Publish(ctx context.Context, body []byte) error
+}
+
+// Consumer binds a use case to a Source. Each message body is decoded and validated as the use case input
+// and run through the middleware chain. Failures usecase.Transient classifies as transient are retried with
+// backoff up to MaxAttempts, after which (or immediately for invalid input and other failures) the message is
+// published to DeadLetter.
+type Consumer[I any, O any] struct {
+	UseCase usecase.UseCase[I, O]
+	Source  Source
+	// Concurrency is the number of messages processed at once
+	Concurrency int
+	MaxAttempts int
+	// Backoff is the delay before a failed message is returned to the source for the given attempt
+	Backoff    func(attempt int) time.Duration
+	DeadLetter Sink
+	Logger     log.UseCaseLogger
+	// OnResult is called with the output of every successfully processed message
+	OnResult func(ctx context.Context, input I, output O)
+}
+
+func NewConsumer[I any, O any](uc usecase.UseCase[I, O], source Source, options ...func(c *Consumer[I, O])) *Consumer[I, O] {
+	c := &Consumer[I, O]{
+		UseCase:     uc,
+		Source:      source,
+		Concurrency: 1,
+		MaxAttempts: 3,
+		Backoff:     ExponentialBackoff(100*time.Millisecond, 10*time.Second),
+	}
+
+	for _, v := range options {
+		v(c)
+	}
+
+	return c
+}
+
+// Run consumes until the context is done or the source is closed and drained. Messages already received
+// are allowed to finish before Run returns, and once the source is closed those they return to it for a
+// retry are consumed as well.
+func (c *Consumer[I, O]) Run(ctx context.Context) error {
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	slots := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	// drained is set once the source was found closed with no handler running which could Nack into it
+	drained := false
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		m, err := c.Source.Receive(ctx)
+		if err != nil {
+			<-slots
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case errors.Is(err, ErrClosed) && drained:
+				return nil
+			case errors.Is(err, ErrClosed):
+				wg.Wait()
+				drained = true
+				continue
+			}
+			return err
+		}
+		drained = false
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			c.handle(ctx, m)
+		}()
+	}
+}
+
+func (c *Consumer[I, O]) handle(ctx context.Context, m Message) {
+	in, err := c.UseCase.DecodeJSON(m.Body())
+	if err != nil {
+		c.deadLetter(ctx, m, err, nil)
+		return
+	}
+
+	out, err := c.UseCase.Execute(ctx, in)
+	if err == nil {
+		if c.OnResult != nil {
+			c.OnResult(ctx, in, out)
+		}
+		c.ack(m)
+		return
+	}
+
+	if !usecase.Transient(err) || m.Attempt() >= c.MaxAttempts {
+		c.deadLetter(ctx, m, err, in)
+		return
+	}
+
+	if c.Backoff != nil {
+		select {
+		case <-time.After(c.Backoff(m.Attempt())):
+		case <-ctx.Done():
+		}
+	}
+
+	if err = m.Nack(); err != nil {
+		c.log(err)
+	}
+}
+
+// deadLetter gives up on a message, scrubbing the redacted values of its input from the logged cause
+func (c *Consumer[I, O]) deadLetter(ctx context.Context, m Message, cause error, input any) {
+	c.log(fmt.Sprintf("dead-lettering message after %d attempt(s): %s", m.Attempt(), redact.Scrub(cause.Error(), input)))
+
+	if c.DeadLetter != nil {
+		if err := c.DeadLetter.Publish(ctx, m.Body()); err != nil {
+			// Leave the message with the source rather than lose it
+			c.log(err)
+			if err = m.Nack(); err != nil {
+				c.log(err)
+			}
+			return
+		}
+	}
+
+	c.ack(m)
+}
+
+func (c *Consumer[I, O]) ack(m Message) {
+	if err := m.Ack(); err != nil {
+		c.log(err)
+	}
+}
+
+func (c *Consumer[I, O]) log(args ...any) {
+	if c.Logger != nil {
+		c.Logger.Log(args...)
+	}
+}
+
+// ExponentialBackoff doubles the delay for each attempt starting at base, capped at max, with up to
+// half of the delay replaced by random jitter. It is the same backoff as use case retries.
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return usecase.ExponentialBackoff(base, max)
+}
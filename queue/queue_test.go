@@ -0,0 +1,257 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase"
+	"github.com/swaggest/usecase/status"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type job struct {
+	ID       string `json:"id" required:"true" minLength:"1"`
+	Failures int    `json:"failures"`
+	Fatal    bool   `json:"fatal"`
+}
+
+type result struct {
+	ID string `json:"id"`
+}
+
+// tracker records what the use case saw so the tests can assert against it
+type tracker struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	done     []string
+	inflight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (tr *tracker) useCase(tt *testing.T) usecase.UseCase[job, *result] {
+	uc, err := usecase.New(job{}, &result{}, func(ctx context.Context, input job, output *result) error {
+		n := tr.inflight.Add(1)
+		defer tr.inflight.Add(-1)
+		for {
+			peak := tr.peak.Load()
+			if n <= peak || tr.peak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		tr.attempts[input.ID]++
+
+		if input.Fatal {
+			return status.Wrap(errors.New("cannot process"), status.FailedPrecondition)
+		}
+		if tr.attempts[input.ID] <= input.Failures {
+			return status.Wrap(errors.New("downstream unavailable"), status.Unavailable)
+		}
+
+		output.ID = input.ID
+		return nil
+	}, nil, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	return uc
+}
+
+func (tr *tracker) onResult(ctx context.Context, input job, output *result) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.done = append(tr.done, output.ID)
+}
+
+func (tr *tracker) attemptsFor(id string) int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.attempts[id]
+}
+
+func (tr *tracker) doneCount() int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return len(tr.done)
+}
+
+func TestConsumer_Run(tt *testing.T) {
+	spoolSource := func(tt *testing.T) (Source, Sink) {
+		s, err := NewSpool(tt.TempDir())
+		if err != nil {
+			tt.Fatal(err)
+		}
+		s.PollInterval = time.Millisecond
+		return s, s
+	}
+	channelSource := func(tt *testing.T) (Source, Sink) {
+		c := NewChannel(16)
+		return c, c
+	}
+
+	tests := []struct {
+		name          string
+		source        func(tt *testing.T) (Source, Sink)
+		messages      []string
+		concurrency   int
+		assertionFunc func(t *wrapt.T, tr *tracker, dead *Channel)
+	}{
+		{
+			name:        "processes every message within the concurrency limit",
+			source:      channelSource,
+			messages:    []string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`, `{"id":"d"}`, `{"id":"e"}`},
+			concurrency: 2,
+			assertionFunc: func(t *wrapt.T, tr *tracker, dead *Channel) {
+				t.A.Eventually(func() bool { return tr.doneCount() == 5 }, time.Second, time.Millisecond)
+				t.A.LessOrEqual(tr.peak.Load(), int32(2))
+				t.A.Equal(0, dead.Len())
+			},
+		},
+		{
+			name:     "transient failures are retried",
+			source:   channelSource,
+			messages: []string{`{"id":"a","failures":2}`},
+			assertionFunc: func(t *wrapt.T, tr *tracker, dead *Channel) {
+				t.A.Eventually(func() bool { return tr.doneCount() == 1 }, time.Second, time.Millisecond)
+				t.A.Equal(3, tr.attemptsFor("a"))
+			},
+		},
+		{
+			name:     "retries are bounded by max attempts",
+			source:   channelSource,
+			messages: []string{`{"id":"a","failures":10}`},
+			assertionFunc: func(t *wrapt.T, tr *tracker, dead *Channel) {
+				t.A.Eventually(func() bool { return dead.Len() == 1 }, time.Second, time.Millisecond)
+				t.A.Equal(3, tr.attemptsFor("a"))
+			},
+		},
+		{
+			name:     "permanent failures are dead-lettered without retry",
+			source:   channelSource,
+			messages: []string{`{"id":"a","fatal":true}`},
+			assertionFunc: func(t *wrapt.T, tr *tracker, dead *Channel) {
+				t.A.Eventually(func() bool { return dead.Len() == 1 }, time.Second, time.Millisecond)
+				t.A.Equal(1, tr.attemptsFor("a"))
+			},
+		},
+		{
+			name:     "invalid input is dead-lettered before the use case",
+			source:   channelSource,
+			messages: []string{`{"id":""}`, `not json`},
+			assertionFunc: func(t *wrapt.T, tr *tracker, dead *Channel) {
+				t.A.Eventually(func() bool { return dead.Len() == 2 }, time.Second, time.Millisecond)
+				t.A.Equal(0, tr.attemptsFor(""))
+			},
+		},
+		{
+			name:        "spool retries and acks",
+			source:      spoolSource,
+			messages:    []string{`{"id":"a","failures":1}`, `{"id":"b"}`, `{"id":"c","fatal":true}`},
+			concurrency: 3,
+			assertionFunc: func(t *wrapt.T, tr *tracker, dead *Channel) {
+				t.A.Eventually(func() bool { return tr.doneCount() == 2 && dead.Len() == 1 }, time.Second, time.Millisecond)
+				t.A.Equal(2, tr.attemptsFor("a"))
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			tr := &tracker{attempts: map[string]int{}}
+			source, sink := test.source(tt)
+			dead := NewChannel(16)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			for _, v := range test.messages {
+				t.R.Nil(sink.Publish(ctx, []byte(v)))
+			}
+
+			consumer := NewConsumer(tr.useCase(tt), source, func(c *Consumer[job, *result]) {
+				c.Concurrency = test.concurrency
+				c.DeadLetter = dead
+				c.Backoff = nil
+				c.OnResult = tr.onResult
+			})
+
+			finished := make(chan error)
+			go func() {
+				finished <- consumer.Run(ctx)
+			}()
+
+			test.assertionFunc(t, tr, dead)
+
+			cancel()
+			t.A.Nil(<-finished)
+		})
+	}
+}
+
+func TestSpool_Nack(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	s, err := NewSpool(tt.TempDir())
+	t.R.Nil(err)
+
+	ctx := context.Background()
+	t.R.Nil(s.Publish(ctx, []byte(`first`)))
+	t.R.Nil(s.Publish(ctx, []byte(`second`)))
+
+	m, err := s.Receive(ctx)
+	t.R.Nil(err)
+	t.A.Equal("first", string(m.Body()))
+	t.A.Equal(1, m.Attempt())
+	t.A.Equal(1, s.Len())
+
+	t.R.Nil(m.Nack())
+	m, err = s.Receive(ctx)
+	t.R.Nil(err)
+	t.A.Equal("first", string(m.Body()))
+	t.A.Equal(2, m.Attempt())
+	t.R.Nil(m.Ack())
+
+	m, err = s.Receive(ctx)
+	t.R.Nil(err)
+	t.A.Equal("second", string(m.Body()))
+	t.R.Nil(m.Ack())
+	t.A.Equal(0, s.Len())
+}
+
+func TestExponentialBackoff(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		d := backoff(attempt)
+		t.A.LessOrEqual(d, max)
+		t.A.GreaterOrEqual(d, max/2)
+	}
+}
+
+func TestConsumer_Run_closed(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	tr := &tracker{attempts: map[string]int{}}
+	source := NewChannel(16)
+	t.R.Nil(source.Publish(context.Background(), []byte(`{"id":"a","failures":1}`)))
+	source.Close()
+
+	consumer := NewConsumer(tr.useCase(tt), source, func(c *Consumer[job, *result]) {
+		// A free slot lets Run find the source empty while the first attempt is still running
+		c.Concurrency = 2
+		c.Backoff = nil
+		c.OnResult = tr.onResult
+	})
+
+	// The retry is requeued after the source was found empty and closed, and is still consumed
+	t.A.Nil(consumer.Run(context.Background()))
+	t.A.Equal(2, tr.attemptsFor("a"))
+	t.A.Equal(1, tr.doneCount())
+	t.A.Equal(0, source.Len())
+}
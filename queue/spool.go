@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	spoolReady    = ".msg"
+	spoolInflight = ".inflight"
+)
+
+// Spool is a Source and Sink backed by a local directory, one file per message. Messages are claimed
+// by renaming so several consumers (or processes) can share a directory. It is intended for tests and
+// local development rather than as a durable broker.
+type Spool struct {
+	Dir          string
+	PollInterval time.Duration
+	seq          atomic.Uint64
+}
+
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Spool{
+		Dir:          dir,
+		PollInterval: 50 * time.Millisecond,
+	}, nil
+}
+
+func (s *Spool) Publish(ctx context.Context, body []byte) error {
+	name := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), s.seq.Add(1)%1000000)
+	return s.write(name, 1, body)
+}
+
+// write creates the file under a temporary name first so that a half written message is never received
+func (s *Spool) write(name string, attempt int, body []byte) error {
+	tmp := filepath.Join(s.Dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(s.Dir, fmt.Sprintf("%s.%d%s", name, attempt, spoolReady)))
+}
+
+func (s *Spool) Receive(ctx context.Context) (Message, error) {
+	for {
+		entries, err := os.ReadDir(s.Dir)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, 0, len(entries))
+		for _, v := range entries {
+			if !v.IsDir() && strings.HasSuffix(v.Name(), spoolReady) {
+				names = append(names, v.Name())
+			}
+		}
+		sort.Strings(names)
+
+		for _, v := range names {
+			base := strings.TrimSuffix(v, spoolReady)
+			inflight := filepath.Join(s.Dir, base+spoolInflight)
+
+			// Losing the race to another consumer just means trying the next file
+			if err = os.Rename(filepath.Join(s.Dir, v), inflight); err != nil {
+				continue
+			}
+
+			body, err := os.ReadFile(inflight)
+			if err != nil {
+				return nil, err
+			}
+
+			name, attempt := parseSpoolName(base)
+			return &spoolMessage{spool: s, path: inflight, name: name, attempt: attempt, body: body}, nil
+		}
+
+		select {
+		case <-time.After(s.PollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Len is the number of messages waiting to be received
+func (s *Spool) Len() int {
+	matches, _ := filepath.Glob(filepath.Join(s.Dir, "*"+spoolReady))
+	return len(matches)
+}
+
+func parseSpoolName(base string) (string, int) {
+	i := strings.LastIndex(base, ".")
+	if i < 0 {
+		return base, 1
+	}
+
+	attempt, err := strconv.Atoi(base[i+1:])
+	if err != nil {
+		return base, 1
+	}
+
+	return base[:i], attempt
+}
+
+type spoolMessage struct {
+	spool   *Spool
+	path    string
+	name    string
+	attempt int
+	body    []byte
+}
+
+func (m *spoolMessage) Body() []byte {
+	return m.body
+}
+
+func (m *spoolMessage) Attempt() int {
+	return m.attempt
+}
+
+func (m *spoolMessage) Ack() error {
+	return os.Remove(m.path)
+}
+
+func (m *spoolMessage) Nack() error {
+	return os.Rename(m.path, filepath.Join(m.spool.Dir, fmt.Sprintf("%s.%d%s", m.name, m.attempt+1, spoolReady)))
+}
@@ -0,0 +1,302 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/swaggest/jsonschema-go"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Strategy is how the value of a redacted field is masked, given in its redact tag
+type Strategy string
+
+const (
+	// Full replaces the value with Masked, for redact:"true" or redact:"full"
+	Full Strategy = "full"
+	// Last4 keeps the last four characters, such as those of a card number, masking the rest
+	Last4 Strategy = "last4"
+	// Hash replaces the value with a short SHA-256 digest, so that records about the same value can be
+	// correlated without revealing it. Values which are easily guessed, like PINs, should use Full.
+	Hash Strategy = "hash"
+	// None keeps the value of a field whose name would otherwise have it redacted, for redact:"false"
+	None Strategy = "false"
+)
+
+// Masked replaces values redacted with Full
+const Masked = "[REDACTED]"
+
+// sensitive are the names, lower cased without separators, of fields which are redacted with Full
+// unless tagged otherwise
+var sensitive = map[string]bool{
+	"password": true, "passwd": true, "secret": true, "token": true, "accesstoken": true,
+	"refreshtoken": true, "apikey": true, "authorization": true, "cookie": true, "creditcard": true,
+	"cardnumber": true, "cvv": true, "ssn": true, "privatekey": true, "clientsecret": true,
+}
+
+func isSensitive(name string) bool {
+	return sensitive[strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))]
+}
+
+// strategyOf reads the redact tag of a field, falling back to Full for fields named like secrets
+func strategyOf(sf reflect.StructField, name string) Strategy {
+	switch tag, ok := sf.Tag.Lookup("redact"); {
+	case !ok:
+		if isSensitive(sf.Name) || isSensitive(name) {
+			return Full
+		}
+		return ""
+	case tag == string(None) || tag == "-":
+		return ""
+	case tag == string(Last4), tag == string(Hash):
+		return Strategy(tag)
+	default:
+		// Anything else, true and full included, errs on the side of revealing nothing
+		return Full
+	}
+}
+
+// Mask masks a single value with the strategy
+func Mask(s string, strategy Strategy) string {
+	switch strategy {
+	case "", None:
+		return s
+	case Last4:
+		if len(s) <= 4 {
+			return "****"
+		}
+		return "****" + s[len(s)-4:]
+	case Hash:
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	default:
+		return Masked
+	}
+}
+
+// Value returns a copy of v made of maps, slices and plain values, keyed by the json names of the
+// struct fields they came from, with the redacted fields masked at any depth. Fields tagged json:"-"
+// are left out.
+func Value(v any) any {
+	w := walker{}
+	return w.value(reflect.ValueOf(v))
+}
+
+// JSON encodes v as JSON with its redacted fields masked
+func JSON(v any) (json.RawMessage, error) {
+	b, err := json.Marshal(Value(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Secrets returns the values of v which are redacted, for scrubbing from text such as error messages
+// which may have quoted them. Values shorter than four characters are left out as they would match
+// too much.
+func Secrets(v any) []string {
+	w := walker{secrets: map[string]bool{}}
+	w.value(reflect.ValueOf(v))
+
+	out := make([]string, 0, len(w.secrets))
+	for s := range w.secrets {
+		out = append(out, s)
+	}
+	// Longest first, so that a secret containing another is replaced whole
+	sort.Slice(out, func(i, j int) bool { return len(out[i]) > len(out[j]) })
+
+	return out
+}
+
+// Scrub replaces the secrets of v found in s with Masked
+func Scrub(s string, v any) string {
+	for _, secret := range Secrets(v) {
+		s = strings.ReplaceAll(s, secret, Masked)
+	}
+
+	return s
+}
+
+type walker struct {
+	// secrets collects the redacted values when set
+	secrets map[string]bool
+}
+
+func (w walker) value(v reflect.Value) any {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+
+	// Structs marshalling themselves are walked all the same when they have fields to redact, which their
+	// MarshalJSON would reveal
+	if m, ok := v.Interface().(json.Marshaler); ok && (v.Kind() != reflect.Struct || !redacts(v.Type(), map[reflect.Type]bool{})) {
+		return m
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := map[string]any{}
+		w.fields(v, out)
+		return out
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		out := map[string]any{}
+		for _, k := range v.MapKeys() {
+			if isSensitive(k.String()) {
+				out[k.String()] = w.mask(v.MapIndex(k), Full)
+				continue
+			}
+			out[k.String()] = w.value(v.MapIndex(k))
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		out := make([]any, v.Len())
+		for k := range out {
+			out[k] = w.value(v.Index(k))
+		}
+		return out
+	case reflect.Func, reflect.Chan:
+		return nil
+	default:
+		return v.Interface()
+	}
+}
+
+func (w walker) fields(v reflect.Value, out map[string]any) {
+	t := v.Type()
+	for k := 0; k < t.NumField(); k++ {
+		sf := t.Field(k)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if sf.Anonymous && name == "" {
+			fv := v.Field(k)
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				w.fields(fv, out)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		if strategy := strategyOf(sf, name); strategy != "" {
+			out[name] = w.mask(v.Field(k), strategy)
+			continue
+		}
+		out[name] = w.value(v.Field(k))
+	}
+}
+
+// redacts reports whether a type has fields which are redacted at any depth
+func redacts(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return redacts(t.Elem(), seen)
+	case reflect.Struct:
+		for k := 0; k < t.NumField(); k++ {
+			sf := t.Field(k)
+			name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if name == "-" || !sf.IsExported() && !sf.Anonymous {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			if strategyOf(sf, name) != "" || redacts(sf.Type, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// mask masks the value of a redacted field, element by element for slices and maps of plain values
+func (w walker) mask(v reflect.Value, strategy Strategy) any {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return Masked
+		}
+		out := make([]any, v.Len())
+		for k := range out {
+			out[k] = w.mask(v.Index(k), strategy)
+		}
+		return out
+	case reflect.Map:
+		out := map[string]any{}
+		for _, k := range v.MapKeys() {
+			out[fmt.Sprint(k.Interface())] = w.mask(v.MapIndex(k), strategy)
+		}
+		return out
+	case reflect.Struct, reflect.Func, reflect.Chan:
+		return Masked
+	}
+
+	s := fmt.Sprint(v.Interface())
+	if w.secrets != nil && len(s) >= 4 {
+		w.secrets[s] = true
+	}
+
+	return Mask(s, strategy)
+}
+
+// InterceptProp documents fields tagged to be redacted with Full as writeOnly, and strings among them
+// with the password format, since they are secrets which are sent rather than read. Fields only
+// redacted for their name, like the token of a login response, are left as they are. It is added to
+// the DefaultOptions of a jsonschema.Reflector.
+var InterceptProp = jsonschema.InterceptProp(func(params jsonschema.InterceptPropParams) error {
+	if !params.Processed || params.PropertySchema == nil {
+		return nil
+	}
+
+	if _, tagged := params.Field.Tag.Lookup("redact"); !tagged || strategyOf(params.Field, params.Name) != Full {
+		return nil
+	}
+
+	params.PropertySchema.WithExtraPropertiesItem("writeOnly", true)
+	if params.PropertySchema.HasType(jsonschema.String) {
+		params.PropertySchema.WithFormat("password")
+	}
+
+	return nil
+})
@@ -0,0 +1,164 @@
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/swaggest/jsonschema-go"
+	"testing"
+	"time"
+)
+
+type credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type payment struct {
+	Card    string   `json:"card" redact:"last4"`
+	Email   string   `json:"email" redact:"hash"`
+	PIN     string   `json:"pin" redact:"true"`
+	Token   string   `json:"token" redact:"false"`
+	Backups []string `json:"backups" redact:"full"`
+	Secret  struct {
+		Value string `json:"value"`
+	} `json:"secret"`
+}
+
+type signup struct {
+	credentials
+	Email    string            `json:"email"`
+	APIKey   string            `json:"api_key"`
+	Owner    *credentials      `json:"owner,omitempty"`
+	Born     time.Time         `json:"born"`
+	Labels   map[string]string `json:"labels"`
+	Payments []payment         `json:"payments"`
+	Internal string            `json:"-"`
+	secret   string
+}
+
+// pinned marshals itself, which redaction mustn't take as a way around its tags
+type pinned struct {
+	Name string `json:"name"`
+	PIN  string `json:"pin" redact:"true"`
+}
+
+func (p pinned) MarshalJSON() ([]byte, error) {
+	type plain pinned
+	return json.Marshal(plain(p))
+}
+
+type stamped struct {
+	At string `json:"at"`
+}
+
+func (s stamped) MarshalJSON() ([]byte, error) {
+	return json.Marshal("at " + s.At)
+}
+
+func TestJSON(tt *testing.T) {
+	born := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input any
+		want  string
+	}{
+		{
+			name: "struct",
+			input: signup{
+				credentials: credentials{User: "sam", Password: "hunter2"},
+				Email:       "sam@example.com",
+				APIKey:      "k",
+				Owner:       &credentials{User: "alex", Password: "swordfish"},
+				Born:        born,
+				Labels:      map[string]string{"team": "a", "token": "t"},
+				Internal:    "x",
+				secret:      "y",
+			},
+			want: `{"api_key":"[REDACTED]","born":"2020-05-01T00:00:00Z","email":"sam@example.com","labels":{"team":"a","token":"[REDACTED]"},"owner":{"password":"[REDACTED]","user":"alex"},"password":"[REDACTED]","payments":[],"user":"sam"}`,
+		},
+		{
+			name: "strategies",
+			input: []payment{{
+				Card:    "4111111111111111",
+				Email:   "sam@example.com",
+				PIN:     "1234",
+				Token:   "visible",
+				Backups: []string{"abc", "def"},
+			}},
+			want: `[{"backups":["[REDACTED]","[REDACTED]"],"card":"****1111","email":"sha256:cd25a6171969f2a3","pin":"[REDACTED]","secret":"[REDACTED]","token":"visible"}]`,
+		},
+		{name: "pointer", input: &credentials{User: "sam", Password: "p"}, want: `{"password":"[REDACTED]","user":"sam"}`},
+		{name: "slice", input: []credentials{{User: "a", Password: "b"}}, want: `[{"password":"[REDACTED]","user":"a"}]`},
+		{name: "map", input: map[string]credentials{"a": {User: "a", Password: "b"}}, want: `{"a":{"password":"[REDACTED]","user":"a"}}`},
+		{name: "nil", input: nil, want: `null`},
+		{
+			name:  "nested marshallers with redacted fields",
+			input: struct{ Card pinned }{Card: pinned{Name: "rex", PIN: "1234"}},
+			want:  `{"Card":{"name":"rex","pin":"[REDACTED]"}}`,
+		},
+		{name: "marshallers without", input: []stamped{{At: "noon"}}, want: `["at noon"]`},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			got, err := JSON(test.input)
+			t.R.Nil(err)
+			t.A.JSONEq(test.want, string(got))
+		})
+	}
+}
+
+func TestMask(tt *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		strategy Strategy
+		want     string
+	}{
+		{name: "full", value: "hunter2", strategy: Full, want: Masked},
+		{name: "unknown", value: "hunter2", strategy: "rot13", want: Masked},
+		{name: "last4", value: "4111111111111111", strategy: Last4, want: "****1111"},
+		{name: "last4 of short", value: "123", strategy: Last4, want: "****"},
+		{name: "hash", value: "sam@example.com", strategy: Hash, want: "sha256:cd25a6171969f2a3"},
+		{name: "none", value: "hunter2", strategy: None, want: "hunter2"},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			t.A.Equal(test.want, Mask(test.value, test.strategy))
+		})
+	}
+}
+
+func TestScrub(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	input := signup{
+		credentials: credentials{User: "sam", Password: "hunter2"},
+		Payments:    []payment{{Card: "4111111111111111", PIN: "12", Token: "visible"}},
+	}
+	err := errors.New(`sam could not sign in with "hunter2" paying with 4111111111111111 (pin 12, token visible)`)
+
+	t.A.Equal([]string{"4111111111111111", "hunter2"}, Secrets(input))
+	t.A.Equal(`sam could not sign in with "[REDACTED]" paying with [REDACTED] (pin 12, token visible)`, Scrub(err.Error(), input))
+	t.A.Equal("nothing to hide", Scrub("nothing to hide", nil))
+}
+
+func TestInterceptProp(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	r := jsonschema.Reflector{}
+	s, err := r.Reflect(payment{}, InterceptProp)
+	t.R.Nil(err)
+
+	b, err := s.JSONSchemaBytes()
+	t.R.Nil(err)
+	t.A.Contains(string(b), `"pin":{"type":"string","format":"password","writeOnly":true}`)
+	t.A.Contains(string(b), `"backups":{"items":{"type":"string"},"type":["array","null"],"writeOnly":true}`)
+	t.A.Contains(string(b), `"card":{"type":"string"}`)
+	t.A.Contains(string(b), `"token":{"type":"string"}`)
+}
@@ -0,0 +1,358 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/usecase"
+	"github.com/swaggest/usecase/status"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned, with the Unavailable status, while a use case's circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Retries counts the retried attempts per use case, published with expvar
+var Retries = expvar.NewMap("usecase_retries")
+
+var breakers = struct {
+	sync.Mutex
+	all map[string]*CircuitBreaker
+}{all: map[string]*CircuitBreaker{}}
+
+func init() {
+	expvar.Publish("usecase_circuit_breakers", expvar.Func(func() any {
+		breakers.Lock()
+		defer breakers.Unlock()
+
+		out := map[string]BreakerStats{}
+		for k, v := range breakers.all {
+			out[k] = v.Stats()
+		}
+		return out
+	}))
+}
+
+// Transient reports whether an error is classified as likely to go away when retried: the Unavailable,
+// DeadlineExceeded and ResourceExhausted statuses. Unclassified errors are not, as retrying them could run
+// a use case which isn't idempotent twice, and neither are open circuit breakers.
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var ws rest.ErrWithCanonicalStatus
+	if errors.As(err, &ws) {
+		return transientStatus(ws.Status())
+	}
+
+	var code status.Code
+	return errors.As(err, &code) && transientStatus(code)
+}
+
+func transientStatus(code status.Code) bool {
+	return code == status.Unavailable || code == status.DeadlineExceeded || code == status.ResourceExhausted
+}
+
+// BreakerFailure is the default Failure of a CircuitBreaker: transient errors, server errors and panics,
+// which say nothing about whether a retry would work but do say the use case is broken
+func BreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var p *PanicError
+	if Transient(err) || errors.As(err, &p) {
+		return true
+	}
+
+	code, _ := rest.Err(err)
+	return code >= http.StatusInternalServerError
+}
+
+// ExponentialBackoff doubles the delay for each attempt starting at base, capped at max, with up to
+// half of the delay replaced by random jitter.
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+
+		half := d / 2
+		if half <= 0 {
+			return d
+		}
+		return half + time.Duration(rand.Int63n(int64(half)))
+	}
+}
+
+// RetryPolicy retries the use case func (the middleware run once) while it fails with retryable errors.
+// The output is reused between attempts so the use case should only set it once it has succeeded.
+type RetryPolicy struct {
+	// MaxAttempts includes the first one, defaults to 3
+	MaxAttempts int
+	// Backoff is the delay after a failed attempt, defaults to ExponentialBackoff(100ms, 2s). No retry
+	// is made when the delay would run past the deadline of the context.
+	Backoff func(attempt int) time.Duration
+	// Retryable defaults to Transient
+	Retryable func(err error) bool
+}
+
+func (p RetryPolicy) run(ctx context.Context, name func() string, fn func() error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 3
+	}
+	backoff := p.Backoff
+	if backoff == nil {
+		backoff = ExponentialBackoff(100*time.Millisecond, 2*time.Second)
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = Transient
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return err
+		}
+
+		delay := backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		Retries.Add(name(), 1)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker fails calls fast once FailureThreshold consecutive calls have failed. After OpenFor a
+// single trial call is let through, closing the breaker when it succeeds and reopening it when it fails.
+type CircuitBreaker struct {
+	Name string
+	// FailureThreshold defaults to 5
+	FailureThreshold int
+	// OpenFor defaults to 30 seconds
+	OpenFor time.Duration
+	// Failure classifies the errors counted as failures, defaults to BreakerFailure. Other errors count as
+	// successes as they show the use case is reachable.
+	Failure func(err error) bool
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+	opens    uint64
+	rejected uint64
+}
+
+type BreakerStats struct {
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	Opens    uint64 `json:"opens"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// NewCircuitBreaker creates a breaker and publishes its stats under its name, which must not be taken by
+// another breaker
+func NewCircuitBreaker(name string, options ...func(b *CircuitBreaker)) (*CircuitBreaker, error) {
+	b := &CircuitBreaker{
+		Name:             name,
+		FailureThreshold: 5,
+		OpenFor:          30 * time.Second,
+		Failure:          BreakerFailure,
+		state:            BreakerClosed,
+	}
+
+	for _, v := range options {
+		v(b)
+	}
+
+	breakers.Lock()
+	defer breakers.Unlock()
+	if _, ok := breakers.all[name]; ok {
+		return nil, fmt.Errorf("a circuit breaker named %s already exists", name)
+	}
+	breakers.all[name] = b
+
+	return b, nil
+}
+
+// Close stops publishing the stats of the breaker, freeing its name
+func (b *CircuitBreaker) Close() {
+	breakers.Lock()
+	defer breakers.Unlock()
+	if breakers.all[b.Name] == b {
+		delete(breakers.all, b.Name)
+	}
+}
+
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.OpenFor {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
+
+func (b *CircuitBreaker) Stats() BreakerStats {
+	state := b.State()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStats{State: state, Failures: b.failures, Opens: b.opens, Rejected: b.rejected}
+}
+
+// Allow returns an Unavailable ErrCircuitOpen when the call may not go ahead
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.OpenFor {
+		b.state = BreakerHalfOpen
+	}
+
+	switch {
+	case b.state == BreakerClosed:
+		return nil
+	case b.state == BreakerHalfOpen && !b.trial:
+		b.trial = true
+		return nil
+	}
+
+	b.rejected++
+	return status.Wrap(ErrCircuitOpen, status.Unavailable)
+}
+
+// Record reports the outcome of an allowed call, cancellations counting as neither success nor failure
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failure := b.Failure
+	if failure == nil {
+		failure = BreakerFailure
+	}
+	threshold := b.FailureThreshold
+	if threshold < 1 {
+		threshold = 5
+	}
+
+	b.trial = false
+	// A cancelled call says nothing either way, so a trial cut short leaves the breaker half-open for the next
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if !failure(err) {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.opens++
+	}
+}
+
+// Retry returns a copy of the use case retrying its func as described by the policy
+func (i UseCase[I, O]) Retry(policy RetryPolicy) UseCase[I, O] {
+	i.retry = &policy
+	return i
+}
+
+// Breaker returns a copy of the use case guarded by the circuit breaker, the breaker being shared
+// with every other copy it is given to
+func (i UseCase[I, O]) Breaker(b *CircuitBreaker) UseCase[I, O] {
+	i.breaker = b
+	return i
+}
+
+// Describe summarises the resilience policies of the use case and their current state for Routes()
+func (i UseCase[I, O]) Describe() string {
+	var parts []string
+	if i.retry != nil {
+		attempts := i.retry.MaxAttempts
+		if attempts < 1 {
+			attempts = 3
+		}
+		parts = append(parts, fmt.Sprintf("retry x%d", attempts))
+	}
+	if i.breaker != nil {
+		parts = append(parts, fmt.Sprintf("breaker %s %s", i.breaker.Name, i.breaker.State()))
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ", ")
+}
+
+// call runs the use case func behind the breaker and retry policy when they are set
+func (i UseCase[I, O]) call(ctx context.Context, input I, output O) error {
+	run := func() error {
+		return recovered(func() string { return StageUseCase }, func() error {
+			return i.usecase(ctx, input, output)
+		})
+	}
+
+	if i.breaker != nil {
+		if err := i.breaker.Allow(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if i.retry != nil {
+		err = i.retry.run(ctx, i.name, run)
+	} else {
+		err = run()
+	}
+
+	if i.breaker != nil {
+		i.breaker.Record(err)
+	}
+
+	return err
+}
+
+// name is the title of the use case, or its input type without one
+func (i UseCase[I, O]) name() string {
+	if i.apiDecorationFunc != nil {
+		u := usecase.NewIOI(i.input, i.output, nil)
+		i.apiDecorationFunc(&u)
+		if u.Title() != "" {
+			return u.Title()
+		}
+	}
+
+	return fmt.Sprintf("%T", i.input)
+}
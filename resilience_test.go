@@ -0,0 +1,275 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/swaggest/rest/web"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransient(tt *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "unavailable", err: status.Wrap(errors.New("down"), status.Unavailable), want: true},
+		{name: "unclassified", err: errors.New("plain errors are internal"), want: false},
+		{name: "internal", err: status.Wrap(errors.New("broken"), status.Internal), want: false},
+		{name: "rate limited", err: status.Wrap(errors.New("slow down"), status.ResourceExhausted), want: true},
+		{name: "deadline exceeded", err: status.Wrap(errors.New("too slow"), status.DeadlineExceeded), want: true},
+		{name: "bare status", err: status.Unavailable, want: true},
+		{name: "invalid", err: status.Wrap(errors.New("bad"), status.InvalidArgument), want: false},
+		{name: "not found", err: status.NotFound, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "panic", err: &PanicError{Stage: StageUseCase, Value: "boom"}, want: false},
+		{name: "open breaker", err: status.Wrap(ErrCircuitOpen, status.Unavailable), want: false},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			t.A.Equal(test.want, Transient(test.err))
+		})
+	}
+}
+
+func TestUseCase_Retry(tt *testing.T) {
+	type Input struct{}
+	type Output struct {
+		Attempts int `json:"attempts"`
+	}
+
+	unavailable := status.Wrap(errors.New("down"), status.Unavailable)
+	conflict := errors.New("conflict")
+	noDelay := func(attempt int) time.Duration { return 0 }
+
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		failures     int
+		failWith     error
+		ctx          func() (context.Context, context.CancelFunc)
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "recovers from transient errors",
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: noDelay},
+			failures:     2,
+			failWith:     unavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after max attempts",
+			policy:       RetryPolicy{MaxAttempts: 2, Backoff: noDelay},
+			failures:     5,
+			failWith:     unavailable,
+			wantErr:      true,
+			wantAttempts: 2,
+		},
+		{
+			name:         "doesn't retry other errors",
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: noDelay},
+			failures:     5,
+			failWith:     status.Wrap(errors.New("bad"), status.InvalidArgument),
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:     "stops before the deadline",
+			policy:   RetryPolicy{MaxAttempts: 5, Backoff: func(attempt int) time.Duration { return time.Second }},
+			failures: 5,
+			failWith: unavailable,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "custom classification",
+			policy: RetryPolicy{MaxAttempts: 3, Backoff: noDelay, Retryable: func(err error) bool {
+				return errors.Is(err, conflict)
+			}},
+			failures:     1,
+			failWith:     status.Wrap(conflict, status.Aborted),
+			wantAttempts: 2,
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			attempts := 0
+			uc, err := New(Input{}, &Output{}, func(ctx context.Context, input Input, output *Output) error {
+				attempts++
+				if attempts <= test.failures {
+					return test.failWith
+				}
+				output.Attempts = attempts
+				return nil
+			}, nil, nil)
+			t.R.Nil(err)
+
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if test.ctx != nil {
+				ctx, cancel = test.ctx()
+			}
+			defer cancel()
+
+			out, err := uc.Retry(test.policy).Execute(ctx, Input{})
+			t.A.Equal(test.wantErr, err != nil)
+			t.A.Equal(test.wantAttempts, attempts)
+			if !test.wantErr {
+				t.A.Equal(test.wantAttempts, out.Attempts)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	type Input struct{}
+	type Output struct {
+		OK bool `json:"ok"`
+	}
+
+	failing := true
+	calls := 0
+	uc, err := New(Input{}, &Output{}, func(ctx context.Context, input Input, output *Output) error {
+		calls++
+		if failing {
+			return status.Wrap(errors.New("dependency down"), status.Unavailable)
+		}
+		output.OK = true
+		return nil
+	}, nil, nil)
+	t.R.Nil(err)
+
+	b, err := NewCircuitBreaker("TestCircuitBreaker", func(b *CircuitBreaker) {
+		b.FailureThreshold = 2
+		b.OpenFor = 50 * time.Millisecond
+	})
+	t.R.Nil(err)
+	defer b.Close()
+	uc = uc.Breaker(b)
+
+	s := web.DefaultService()
+	s.Method(http.MethodGet, "/ping", uc.Handler())
+	get := func() int {
+		res := httptest.NewRecorder()
+		s.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		return res.Code
+	}
+
+	t.Run("opens after the threshold", func(t *wrapt.T) {
+		t.A.Equal(http.StatusServiceUnavailable, get())
+		t.A.Equal(BreakerClosed, b.State())
+		t.A.Equal(http.StatusServiceUnavailable, get())
+		t.A.Equal(BreakerOpen, b.State())
+		t.A.Equal("breaker TestCircuitBreaker open", uc.Describe())
+	})
+
+	t.Run("fails fast while open", func(t *wrapt.T) {
+		failing = false
+		t.A.Equal(http.StatusServiceUnavailable, get())
+		t.A.Equal(2, calls)
+
+		_, err := uc.Execute(context.Background(), Input{})
+		t.A.True(errors.Is(err, ErrCircuitOpen))
+		t.A.Equal(2, calls)
+	})
+
+	t.Run("closes after a successful trial", func(t *wrapt.T) {
+		time.Sleep(60 * time.Millisecond)
+		t.A.Equal(BreakerHalfOpen, b.State())
+		t.A.Equal(http.StatusOK, get())
+		t.A.Equal(BreakerClosed, b.State())
+		t.A.Equal(3, calls)
+	})
+
+	t.Run("reopens after a failed trial", func(t *wrapt.T) {
+		failing = true
+		get()
+		get()
+		t.R.Equal(BreakerOpen, b.State())
+
+		time.Sleep(60 * time.Millisecond)
+		t.A.Equal(http.StatusServiceUnavailable, get())
+		t.A.Equal(BreakerOpen, b.State())
+	})
+
+	t.Run("published with expvar", func(t *wrapt.T) {
+		published := expvar.Get("usecase_circuit_breakers").String()
+		t.A.True(strings.Contains(published, `"TestCircuitBreaker":{"state":"open","failures":3,"opens":3,"rejected":2}`), published)
+	})
+
+	t.Run("names are unique until closed", func(t *wrapt.T) {
+		_, err := NewCircuitBreaker("TestCircuitBreaker")
+		t.A.NotNil(err)
+
+		other, err := NewCircuitBreaker("TestCircuitBreaker_other")
+		t.R.Nil(err)
+		other.Close()
+		other, err = NewCircuitBreaker("TestCircuitBreaker_other")
+		t.R.Nil(err)
+		other.Close()
+	})
+
+	t.Run("cancelled trials are neutral", func(t *wrapt.T) {
+		c, err := NewCircuitBreaker("TestCircuitBreaker_cancelled", func(b *CircuitBreaker) {
+			b.FailureThreshold = 1
+			b.OpenFor = 10 * time.Millisecond
+		})
+		t.R.Nil(err)
+		defer c.Close()
+
+		// Unclassified errors aren't retried but still count against the breaker
+		t.R.Nil(c.Allow())
+		c.Record(errors.New("plain"))
+		t.R.Equal(BreakerOpen, c.State())
+
+		time.Sleep(15 * time.Millisecond)
+		t.R.Nil(c.Allow())
+		c.Record(context.Canceled)
+		t.A.Equal(BreakerHalfOpen, c.State())
+
+		t.R.Nil(c.Allow())
+		c.Record(nil)
+		t.A.Equal(BreakerClosed, c.State())
+	})
+
+	t.Run("panics count as failures", func(t *wrapt.T) {
+		panicking, err := NewCircuitBreaker("TestCircuitBreaker_panics", func(b *CircuitBreaker) {
+			b.FailureThreshold = 2
+		})
+		t.R.Nil(err)
+		defer panicking.Close()
+
+		uc, err := New(Input{}, &Output{}, func(ctx context.Context, input Input, output *Output) error {
+			var m map[string]int
+			m["boom"]++
+			return nil
+		}, nil, nil)
+		t.R.Nil(err)
+		uc = uc.Breaker(panicking)
+
+		for k := 0; k < 2; k++ {
+			_, err = uc.Execute(context.Background(), Input{})
+			var p *PanicError
+			t.A.True(errors.As(err, &p))
+		}
+		t.A.Equal(BreakerOpen, panicking.State())
+		t.A.False(Transient(&PanicError{}))
+	})
+}
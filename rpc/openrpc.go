@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"encoding/json"
+	"github.com/swaggest/jsonschema-go"
+	usecase2 "github.com/swaggest/usecase"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// discoverMethod is the service discovery method defined by the OpenRPC specification
+const discoverMethod = "rpc.discover"
+
+const openRPCVersion = "1.2.6"
+
+type Document struct {
+	OpenRPC string     `json:"openrpc"`
+	Info    Info       `json:"info"`
+	Servers []Endpoint `json:"servers,omitempty"`
+	Methods []Spec     `json:"methods"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Endpoint is the OpenRPC server object, named to avoid clashing with the dispatching Server
+type Endpoint struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type Spec struct {
+	Name           string              `json:"name"`
+	Summary        string              `json:"summary,omitempty"`
+	Description    string              `json:"description,omitempty"`
+	Tags           []Tag               `json:"tags,omitempty"`
+	Deprecated     bool                `json:"deprecated,omitempty"`
+	ParamStructure string              `json:"paramStructure"`
+	Params         []ContentDescriptor `json:"params"`
+	Result         *ContentDescriptor  `json:"result,omitempty"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+type ContentDescriptor struct {
+	Name     string             `json:"name"`
+	Required bool               `json:"required,omitempty"`
+	Schema   *jsonschema.Schema `json:"schema"`
+}
+
+// OpenRPC describes every registered method with schemas reflected from the use case input and output
+func (s *Server) OpenRPC() Document {
+	doc := Document{
+		OpenRPC: openRPCVersion,
+		Info: Info{
+			Title:   s.Title,
+			Version: s.Version,
+		},
+		Servers: []Endpoint{{Name: "default", URL: s.Path}},
+		Methods: []Spec{},
+	}
+
+	r := jsonschema.Reflector{}
+
+	for _, m := range s.Methods() {
+		spec := Spec{
+			Name:           m.Name,
+			ParamStructure: "by-name",
+			Params:         []ContentDescriptor{},
+		}
+
+		var withTitle usecase2.HasTitle
+		if usecase2.As(m.Interactor, &withTitle) {
+			spec.Summary = withTitle.Title()
+		}
+
+		var withDescription usecase2.HasDescription
+		if usecase2.As(m.Interactor, &withDescription) {
+			spec.Description = withDescription.Description()
+		}
+
+		var withTags usecase2.HasTags
+		if usecase2.As(m.Interactor, &withTags) {
+			for _, v := range withTags.Tags() {
+				spec.Tags = append(spec.Tags, Tag{Name: v})
+			}
+		}
+
+		var withDeprecated usecase2.HasIsDeprecated
+		if usecase2.As(m.Interactor, &withDeprecated) {
+			spec.Deprecated = withDeprecated.IsDeprecated()
+		}
+
+		if m.input != nil {
+			if schema, err := r.Reflect(reflect.New(m.input).Elem().Interface(), jsonschema.InlineRefs); err == nil {
+				spec.Params = params(schema)
+			}
+		}
+
+		if m.output != nil {
+			output := m.output
+			if output.Kind() == reflect.Ptr {
+				output = output.Elem()
+			}
+			if schema, err := r.Reflect(reflect.New(output).Interface(), jsonschema.InlineRefs); err == nil {
+				spec.Result = &ContentDescriptor{Name: "result", Schema: &schema}
+			}
+		}
+
+		doc.Methods = append(doc.Methods, spec)
+	}
+
+	return doc
+}
+
+// params splits the input object schema into the by-name content descriptors OpenRPC expects
+func params(schema jsonschema.Schema) []ContentDescriptor {
+	required := map[string]bool{}
+	for _, v := range schema.Required {
+		required[v] = true
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for k := range schema.Properties {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	out := make([]ContentDescriptor, 0, len(names))
+	for _, v := range names {
+		prop := schema.Properties[v]
+		out = append(out, ContentDescriptor{
+			Name:     v,
+			Required: required[v],
+			Schema:   prop.TypeObject,
+		})
+	}
+
+	return out
+}
+
+// OpenRPCHandler serves the OpenRPC document, typically alongside openapi.json
+func (s *Server) OpenRPCHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.OpenRPC())
+	})
+}
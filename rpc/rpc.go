@@ -0,0 +1,359 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/muverum/usecase"
+	"github.com/swaggest/rest"
+	usecase2 "github.com/swaggest/usecase"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const Version = "2.0"
+
+// Error codes defined by the JSON-RPC 2.0 specification. Failures returned by the use case itself
+// are reported as CodeUseCase with the rest.ErrResponse as data.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeUseCase        = -32000
+)
+
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// ID is absent for notifications, which are executed without producing a response
+	ID json.RawMessage `json:"id,omitempty"`
+}
+
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Method is a use case interactor registered under a JSON-RPC method name
+type Method struct {
+	Name       string
+	Interactor usecase2.Interactor
+	input      reflect.Type
+	output     reflect.Type
+}
+
+// Server dispatches JSON-RPC 2.0 calls to registered use cases. It is an http.Handler expecting
+// POST requests and is mounted by api.API at Path when set on the API.
+type Server struct {
+	// Path is where the endpoint is mounted, defaults to /rpc
+	Path string
+	// Title and Version populate the info block of the OpenRPC document
+	Title   string
+	Version string
+	// MaxBatch limits how many calls a batch may contain, defaults to 100
+	MaxBatch int
+	// Concurrency is the maximum number of calls of a batch in flight, defaults to 8
+	Concurrency int
+
+	mu      sync.RWMutex
+	methods map[string]*Method
+}
+
+func New(options ...func(s *Server)) *Server {
+	s := &Server{
+		Path:        "/rpc",
+		MaxBatch:    100,
+		Concurrency: 8,
+		methods:     map[string]*Method{},
+	}
+
+	for _, v := range options {
+		v(s)
+	}
+
+	return s
+}
+
+// Register exposes the use case under an explicit method name
+func (s *Server) Register(name string, h usecase.Interactor) error {
+	if name == "" {
+		return errors.New("a method name is required")
+	}
+
+	i := h.Interactor()
+	m := &Method{
+		Name:       name,
+		Interactor: i,
+	}
+
+	var withInput usecase2.HasInputPort
+	if usecase2.As(i, &withInput) && withInput.InputPort() != nil {
+		m.input = reflect.TypeOf(withInput.InputPort())
+	}
+
+	var withOutput usecase2.HasOutputPort
+	if usecase2.As(i, &withOutput) && withOutput.OutputPort() != nil {
+		m.output = reflect.TypeOf(withOutput.OutputPort())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.methods[name]; ok {
+		return fmt.Errorf("method %s is already registered", name)
+	}
+	s.methods[name] = m
+
+	return nil
+}
+
+// RegisterTitled exposes the use case under a method name derived from its title, so that
+// "Concatenate your request" is callable as concatenateYourRequest.
+func (s *Server) RegisterTitled(h usecase.Interactor) error {
+	var withTitle usecase2.HasTitle
+	if !usecase2.As(h.Interactor(), &withTitle) || withTitle.Title() == "" {
+		return errors.New("use case has no title to derive a method name from")
+	}
+
+	return s.Register(MethodName(withTitle.Title()), h)
+}
+
+// Has reports whether a use case has already been registered under name
+func (s *Server) Has(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.methods[name]
+	return ok
+}
+
+// Methods returns the registered methods sorted by name
+func (s *Server) Methods() []*Method {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	methods := make([]*Method, 0, len(s.methods))
+	for _, v := range s.methods {
+		methods = append(methods, v)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+
+	return methods
+}
+
+// MethodName converts a use case title into a lowerCamelCase method name
+func MethodName(title string) string {
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	sb := strings.Builder{}
+	for k, v := range words {
+		r := []rune(v)
+		if k == 0 {
+			r[0] = unicode.ToLower(r[0])
+		} else {
+			r[0] = unicode.ToUpper(r[0])
+		}
+		sb.WriteString(string(r))
+	}
+
+	return sb.String()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		writeJSON(w, errorResponse(nil, CodeParseError, err.Error(), nil))
+		return
+	}
+
+	data := bytes.TrimSpace(body.Bytes())
+
+	// Batches are a JSON array of requests answered with an array of the non-notification responses
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			writeJSON(w, errorResponse(nil, CodeParseError, err.Error(), nil))
+			return
+		}
+
+		if len(batch) == 0 {
+			writeJSON(w, errorResponse(nil, CodeInvalidRequest, "empty batch", nil))
+			return
+		}
+
+		if s.MaxBatch > 0 && len(batch) > s.MaxBatch {
+			writeJSON(w, errorResponse(nil, CodeInvalidRequest, fmt.Sprintf("batch of %d calls exceeds the limit of %d", len(batch), s.MaxBatch), nil))
+			return
+		}
+
+		responses := make([]*Response, len(batch))
+		slots := make(chan struct{}, max(s.Concurrency, 1))
+		wg := sync.WaitGroup{}
+		for k, v := range batch {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(k int, v json.RawMessage) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				responses[k] = s.call(r.Context(), v)
+			}(k, v)
+		}
+		wg.Wait()
+
+		out := make([]*Response, 0, len(responses))
+		for _, v := range responses {
+			if v != nil {
+				out = append(out, v)
+			}
+		}
+
+		if len(out) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJSON(w, out)
+		return
+	}
+
+	res := s.call(r.Context(), data)
+	if res == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, res)
+}
+
+// call executes a single request, returning nil for notifications. Valid JSON which isn't a request object,
+// such as the elements of [1, 2], is an invalid request rather than a parse error.
+func (s *Server) call(ctx context.Context, data json.RawMessage) *Response {
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(nil, CodeParseError, err.Error(), nil)
+		}
+		return errorResponse(nil, CodeInvalidRequest, err.Error(), nil)
+	}
+
+	if req.JSONRPC != Version || req.Method == "" {
+		return errorResponse(req.ID, CodeInvalidRequest, "invalid request", nil)
+	}
+
+	notification := len(req.ID) == 0
+	result, rpcErr := s.dispatch(ctx, req)
+
+	if notification {
+		return nil
+	}
+
+	if rpcErr != nil {
+		return &Response{JSONRPC: Version, Error: rpcErr, ID: req.ID}
+	}
+
+	// A successful call must always carry a result member, even for use cases without output
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+
+	return &Response{JSONRPC: Version, Result: result, ID: req.ID}
+}
+
+func (s *Server) dispatch(ctx context.Context, req Request) (any, *Error) {
+	if req.Method == discoverMethod {
+		return s.OpenRPC(), nil
+	}
+
+	s.mu.RLock()
+	m, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, &Error{Code: CodeMethodNotFound, Message: "method not found"}
+	}
+
+	var input, output any
+
+	if m.input != nil {
+		params := req.Params
+		if len(params) == 0 {
+			params = json.RawMessage("{}")
+		}
+
+		if err := usecase.ValidateJSON(reflect.Zero(m.input).Interface(), params); err != nil {
+			_, er := rest.Err(err)
+			return nil, &Error{Code: CodeInvalidParams, Message: "invalid params", Data: er}
+		}
+
+		iv := reflect.New(m.input)
+		if err := json.Unmarshal(params, iv.Interface()); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		input = iv.Elem().Interface()
+	}
+
+	if m.output != nil {
+		if m.output.Kind() == reflect.Ptr {
+			output = reflect.New(m.output.Elem()).Interface()
+		} else {
+			output = reflect.New(m.output).Interface()
+		}
+	}
+
+	if err := m.Interactor.Interact(ctx, input, output); err != nil {
+		code, er := rest.Err(err)
+		// Invalid arguments, validation errors and invalid list queries all come back as 400 or 422
+		if code == http.StatusBadRequest || code == http.StatusUnprocessableEntity {
+			return nil, &Error{Code: CodeInvalidParams, Message: er.Error(), Data: er}
+		}
+		return nil, &Error{Code: CodeUseCase, Message: http.StatusText(code), Data: er}
+	}
+
+	return output, nil
+}
+
+func errorResponse(id json.RawMessage, code int, message string, data any) *Response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	return &Response{
+		JSONRPC: Version,
+		Error:   &Error{Code: code, Message: message, Data: data},
+		ID:      id,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,227 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase"
+	usecase2 "github.com/swaggest/usecase"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type sumRequest struct {
+	A int    `json:"a" required:"true"`
+	B int    `json:"b" required:"true"`
+	N string `json:"note" minLength:"2"`
+}
+
+type sumResponse struct {
+	Sum int `json:"sum"`
+}
+
+func testServer(tt *testing.T) *Server {
+	sum, err := usecase.New(sumRequest{}, &sumResponse{}, func(ctx context.Context, input sumRequest, output *sumResponse) error {
+		if input.A < 0 {
+			return status.Wrap(errors.New("negative"), status.FailedPrecondition)
+		}
+		output.Sum = input.A + input.B
+		return nil
+	}, func(i *usecase2.IOInteractor) {
+		i.SetTitle("Sum two numbers")
+		i.SetTags("math")
+	}, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	sum = sum.Validate(func(ctx context.Context, input sumRequest) error {
+		if input.B > 100 {
+			return usecase.FieldError("body:b", "%d is more than 100", input.B)
+		}
+		return nil
+	})
+
+	s := New()
+	if err = s.RegisterTitled(sum); err != nil {
+		tt.Fatal(err)
+	}
+	if err = s.Register("math.add", sum); err != nil {
+		tt.Fatal(err)
+	}
+
+	return s
+}
+
+func TestMethodName(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	t.A.Equal("concatenateYourRequest", MethodName("Concatenate your request"))
+	t.A.Equal("walkDog", MethodName("WalkDog"))
+	t.A.Equal("feedDogV2", MethodName("feed-dog v2"))
+}
+
+func TestServer_ServeHTTP(tt *testing.T) {
+	server := httptest.NewServer(testServer(tt))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		body          string
+		assertionFunc func(t *wrapt.T, res *http.Response)
+	}{
+		{
+			name: "title derived method",
+			body: `{"jsonrpc":"2.0","method":"sumTwoNumbers","params":{"a":1,"b":2},"id":1}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out struct {
+					Result sumResponse `json:"result"`
+					ID     int         `json:"id"`
+				}
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.A.Equal(3, out.Result.Sum)
+				t.A.Equal(1, out.ID)
+			},
+		},
+		{
+			name: "explicit method id",
+			body: `{"jsonrpc":"2.0","method":"math.add","params":{"a":2,"b":2},"id":"x"}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.A.Nil(out.Error)
+				t.A.Equal(`"x"`, string(out.ID))
+			},
+		},
+		{
+			name: "params are validated against the input schema",
+			body: `{"jsonrpc":"2.0","method":"math.add","params":{"a":2,"note":"x"},"id":2}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.NotNil(out.Error)
+				t.A.Equal(CodeInvalidParams, out.Error.Code)
+			},
+		},
+		{
+			name: "validation errors are invalid params",
+			body: `{"jsonrpc":"2.0","method":"math.add","params":{"a":1,"b":101},"id":5}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.NotNil(out.Error)
+				t.A.Equal(CodeInvalidParams, out.Error.Code)
+			},
+		},
+		{
+			name: "use case errors",
+			body: `{"jsonrpc":"2.0","method":"math.add","params":{"a":-1,"b":2},"id":3}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.NotNil(out.Error)
+				t.A.Equal(CodeUseCase, out.Error.Code)
+				t.A.Equal(http.StatusText(http.StatusPreconditionFailed), out.Error.Message)
+			},
+		},
+		{
+			name: "unknown method",
+			body: `{"jsonrpc":"2.0","method":"nope","id":4}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.NotNil(out.Error)
+				t.A.Equal(CodeMethodNotFound, out.Error.Code)
+			},
+		},
+		{
+			name: "notifications produce no response",
+			body: `{"jsonrpc":"2.0","method":"math.add","params":{"a":1,"b":1}}`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				t.A.Equal(http.StatusNoContent, res.StatusCode)
+			},
+		},
+		{
+			name: "batch omits notifications and keeps order",
+			body: `[
+				{"jsonrpc":"2.0","method":"math.add","params":{"a":1,"b":1},"id":1},
+				{"jsonrpc":"2.0","method":"math.add","params":{"a":1,"b":1}},
+				{"jsonrpc":"2.0","method":"math.add","params":{"a":5,"b":5},"id":2},
+				{"jsonrpc":"1.0","method":"math.add","id":3}
+			]`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out []Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.Len(out, 3)
+				t.A.Equal("1", string(out[0].ID))
+				t.A.Equal(map[string]any{"sum": float64(10)}, out[1].Result)
+				t.A.Equal(CodeInvalidRequest, out[2].Error.Code)
+			},
+		},
+		{
+			name: "batch elements which aren't objects are invalid requests",
+			body: `[1, "x", {"jsonrpc":"2.0","method":7,"id":1}]`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out []Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.Len(out, 3)
+				for _, v := range out {
+					t.A.Equal(CodeInvalidRequest, v.Error.Code)
+				}
+			},
+		},
+		{
+			name: "batches over the limit",
+			body: "[" + strings.TrimSuffix(strings.Repeat(`{"jsonrpc":"2.0","method":"math.add","params":{"a":1,"b":1},"id":1},`, 101), ",") + "]",
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.R.NotNil(out.Error)
+				t.A.Equal(CodeInvalidRequest, out.Error.Code)
+				t.A.Contains(out.Error.Message, "limit of 100")
+			},
+		},
+		{
+			name: "parse errors",
+			body: `{"jsonrpc":`,
+			assertionFunc: func(t *wrapt.T, res *http.Response) {
+				var out Response
+				t.R.Nil(json.NewDecoder(res.Body).Decode(&out))
+				t.A.Equal(CodeParseError, out.Error.Code)
+				t.A.Equal("null", string(out.ID))
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			res, err := http.Post(server.URL, "application/json", strings.NewReader(test.body))
+			t.R.Nil(err)
+			defer res.Body.Close()
+
+			if test.assertionFunc != nil {
+				test.assertionFunc(t, res)
+			}
+		})
+	}
+}
+
+func TestServer_OpenRPC(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	doc := testServer(tt).OpenRPC()
+
+	t.R.Len(doc.Methods, 2)
+	t.A.Equal("math.add", doc.Methods[0].Name)
+	t.A.Equal("sumTwoNumbers", doc.Methods[1].Name)
+	t.A.Equal("Sum two numbers", doc.Methods[1].Summary)
+	t.A.Equal([]Tag{{Name: "math"}}, doc.Methods[1].Tags)
+
+	t.R.Len(doc.Methods[0].Params, 3)
+	t.A.Equal("a", doc.Methods[0].Params[0].Name)
+	t.A.True(doc.Methods[0].Params[0].Required)
+	t.A.False(doc.Methods[0].Params[2].Required)
+	t.A.NotNil(doc.Methods[0].Result)
+}
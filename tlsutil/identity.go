@@ -0,0 +1,55 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+// Identity describes the client of a mutual TLS connection from its verified certificate
+type Identity struct {
+	CommonName   string
+	Organization []string
+	DNSNames     []string
+	URIs         []string
+	Emails       []string
+	Certificate  *x509.Certificate
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the client identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// ClientIdentity returns the verified client identity of the request the context belongs to. It is
+// only present on mutual TLS connections whose client certificate was verified.
+func ClientIdentity(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Identify is the middleware adding the client identity of verified connections to the request context
+func Identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		identity := Identity{
+			CommonName:   cert.Subject.CommonName,
+			Organization: cert.Subject.Organization,
+			DNSNames:     cert.DNSNames,
+			Emails:       cert.EmailAddresses,
+			Certificate:  cert,
+		}
+		for _, v := range cert.URIs {
+			identity.URIs = append(identity.URIs, v.String())
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
@@ -0,0 +1,164 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader keeps a certificate (and optionally the CAs used to verify clients) in memory, reloading
+// them when the files change on disk so that rotated certificates are picked up without a restart.
+type Reloader struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// Interval is the least time between checks of the files, defaults to 10 seconds
+	Interval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTime   time.Time
+	checked   time.Time
+}
+
+// NewReloader loads the files once, failing if they can't be used
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: clientCAFile,
+		Interval:     10 * time.Second,
+	}
+
+	if err := r.Load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Load reads the files regardless of whether they changed
+func (r *Reloader) Load() error {
+	modTime, err := r.latest()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.ClientCAFile != "" {
+		if pool, err = LoadCertPool(r.ClientCAFile); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.modTime = modTime
+	r.checked = time.Now()
+
+	return nil
+}
+
+// latest is the most recent modification time of the files
+func (r *Reloader) latest() (time.Time, error) {
+	var latest time.Time
+	for _, v := range []string{r.CertFile, r.KeyFile, r.ClientCAFile} {
+		if v == "" {
+			continue
+		}
+
+		info, err := os.Stat(v)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// refresh reloads the files when they changed since they were last loaded. Failures keep the
+// previous certificate in use as a half written file is likely to be fixed by the next check.
+func (r *Reloader) refresh() {
+	r.mu.RLock()
+	due := time.Since(r.checked) >= r.Interval
+	loaded := r.modTime
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	modTime, err := r.latest()
+	if err == nil && modTime.After(loaded) && r.Load() == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.checked = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.refresh()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.refresh()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+// Config returns a copy of base serving the current certificate and verifying clients against
+// the current CAs on every handshake
+func (r *Reloader) Config(base *tls.Config) *tls.Config {
+	if base == nil {
+		base = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	config := base.Clone()
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.GetCertificate = r.GetCertificate
+		if pool := r.ClientCAs(); pool != nil {
+			c.ClientCAs = pool
+		}
+		return c, nil
+	}
+	config.GetCertificate = r.GetCertificate
+
+	return config
+}
+
+// LoadCertPool reads a PEM file of one or more CA certificates
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,147 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/metrumresearchgroup/wrapt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReloader(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	dir := tt.TempDir()
+
+	certPEM, keyPEM, err := SelfSigned("first.example")
+	t.R.Nil(err)
+	certFile, keyFile, err := WriteKeyPair(dir, "server", certPEM, keyPEM)
+	t.R.Nil(err)
+
+	r, err := NewReloader(certFile, keyFile, "")
+	t.R.Nil(err)
+	r.Interval = 0
+
+	leaf := func() string {
+		cert, err := r.GetCertificate(nil)
+		t.R.Nil(err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		t.R.Nil(err)
+		return parsed.Subject.CommonName
+	}
+	t.A.Equal("first.example", leaf())
+
+	// A broken file keeps the current certificate
+	t.R.Nil(os.WriteFile(certFile, []byte("garbage"), 0o644))
+	later := time.Now().Add(time.Minute)
+	t.R.Nil(os.Chtimes(certFile, later, later))
+	t.A.Equal("first.example", leaf())
+
+	certPEM, keyPEM, err = SelfSigned("second.example")
+	t.R.Nil(err)
+	_, _, err = WriteKeyPair(dir, "server", certPEM, keyPEM)
+	t.R.Nil(err)
+	later = later.Add(time.Minute)
+	t.R.Nil(os.Chtimes(certFile, later, later))
+	t.A.Equal("second.example", leaf())
+
+	_, err = NewReloader(dir+"/missing.crt", keyFile, "")
+	t.A.NotNil(err)
+}
+
+func TestIdentify(tt *testing.T) {
+	ca, err := NewCA("test ca")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	certPEM, keyPEM, err := ca.Issue("alice", "alice.example")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		state         *tls.ConnectionState
+		assertionFunc func(t *wrapt.T, identity Identity, ok bool)
+	}{
+		{
+			name:  "verified client",
+			state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca.Certificate}}},
+			assertionFunc: func(t *wrapt.T, identity Identity, ok bool) {
+				t.R.True(ok)
+				t.A.Equal("alice", identity.CommonName)
+				t.A.Equal([]string{"alice.example"}, identity.DNSNames)
+			},
+		},
+		{
+			name:  "unverified client",
+			state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+			assertionFunc: func(t *wrapt.T, identity Identity, ok bool) {
+				t.A.False(ok)
+			},
+		},
+		{
+			name: "plain http",
+			assertionFunc: func(t *wrapt.T, identity Identity, ok bool) {
+				t.A.False(ok)
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			var identity Identity
+			var ok bool
+			h := Identify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, ok = ClientIdentity(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.TLS = test.state
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			test.assertionFunc(t, identity, ok)
+		})
+	}
+
+	tt.Run("empty context", func(tt *testing.T) {
+		_, ok := ClientIdentity(context.Background())
+		wrapt.WrapT(tt).A.False(ok)
+	})
+}
+
+func TestCA_Issue(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	ca, err := NewCA("test ca")
+	t.R.Nil(err)
+
+	certPEM, keyPEM, err := ca.Issue("server", "localhost", "127.0.0.1")
+	t.R.Nil(err)
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	t.R.Nil(err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	t.R.Nil(err)
+
+	pool := x509.NewCertPool()
+	t.R.True(pool.AppendCertsFromPEM(ca.PEM))
+
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, DNSName: "localhost", KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	t.A.Nil(err)
+	t.A.Nil(cert.VerifyHostname("127.0.0.1"))
+	t.A.NotNil(cert.VerifyHostname("example.com"))
+}
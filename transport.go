@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/swaggest/openapi-go/openapi3"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/rest/jsonschema"
+	"github.com/swaggest/rest/openapi"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// validators caches the JSON schema body validator per input type so that non-HTTP transports
+// don't have to reflect the schema for every message they receive.
+var validators sync.Map
+
+// validatorMu serializes validator construction as the underlying reflector is not safe for concurrent use
+var validatorMu sync.Mutex
+
+var validatorFactory = func() jsonschema.Factory {
+	c := openapi.NewCollector(openapi3.NewReflector())
+	return jsonschema.NewFactory(c, c)
+}()
+
+func bodyValidator(input any) rest.Validator {
+	t := reflect.TypeOf(input)
+	if v, ok := validators.Load(t); ok {
+		return v.(rest.Validator)
+	}
+
+	validatorMu.Lock()
+	defer validatorMu.Unlock()
+
+	if v, ok := validators.Load(t); ok {
+		return v.(rest.Validator)
+	}
+
+	v := validatorFactory.MakeRequestValidator(http.MethodPost, input, nil)
+	validators.Store(t, v)
+	return v
+}
+
+// ValidateJSON checks a JSON document against the schema swaggest derives from the struct tags of input
+// (required, minLength, etc). The returned error carries the InvalidArgument status and the
+// rest.ValidationErrors detail, just as a rejected HTTP request body would.
+func ValidateJSON(input any, data []byte) error {
+	if err := bodyValidator(input).ValidateJSONBody(data); err != nil {
+		return status.Wrap(err, status.InvalidArgument)
+	}
+
+	return nil
+}
+
+// DecodeJSON validates the document against the input schema and then unmarshals it into a new input value.
+// It is the entrypoint for transports which receive their input as raw JSON rather than an *http.Request.
+func (i UseCase[I, O]) DecodeJSON(data []byte) (I, error) {
+	var in I
+
+	if err := ValidateJSON(i.input, data); err != nil {
+		return in, err
+	}
+
+	if err := json.Unmarshal(data, &in); err != nil {
+		return in, status.Wrap(err, status.InvalidArgument)
+	}
+
+	return in, nil
+}
+
+// NewOutput allocates a fresh value of the output type so that concurrent executions never share state.
+func (i UseCase[I, O]) NewOutput() O {
+	return reflect.New(reflect.TypeOf(i.output).Elem()).Interface().(O)
+}
+
+// Execute runs the middleware chain and use case func for the input outside any HTTP handler,
+// returning a newly allocated output.
+func (i UseCase[I, O]) Execute(ctx context.Context, input I) (O, error) {
+	output := i.NewOutput()
+	// The input is given rather than decoded, so it mustn't be read again from a request further up the context
+	ctx = context.WithValue(ctx, requestKey{}, (*http.Request)(nil))
+	err := i.interactor()(ctx, input, output)
+	return output, err
+}
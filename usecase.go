@@ -3,11 +3,13 @@ package usecase
 import (
 	"context"
 	"errors"
+	"github.com/muverum/usecase/audit"
 	"github.com/muverum/usecase/log"
 	"github.com/swaggest/rest/nethttp"
 	"github.com/swaggest/usecase"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 type UseCaseFunc[I any, O any] func(ctx context.Context, input I, output O) error
@@ -25,16 +27,47 @@ type UseCase[I any, O any] struct {
 	// before the actual use case func is called.
 	middleware        []Middleware[I, O]
 	apiDecorationFunc func(IOInteractor *usecase.IOInteractor)
+	deprecation       *Deprecation
+	visibility        string
+	retry             *RetryPolicy
+	breaker           *CircuitBreaker
+	validators        []Validator[I]
+	produces          []string
+	uploads           *UploadLimits
+	pagination        *Pagination
+	audit             audit.Sink
 }
 
-func (i UseCase[I, O]) Use(middlewares ...Middleware[I, O]) {
-	i.middleware = append(i.middleware, middlewares...)
+// Use returns a copy of the use case with the middlewares appended to its chain
+func (i UseCase[I, O]) Use(middlewares ...Middleware[I, O]) UseCase[I, O] {
+	i.middleware = append(append([]Middleware[I, O]{}, i.middleware...), middlewares...)
+	return i
 }
 
 // Handler is used to take an existing usecase and make it available for
 // use with sub routers using chi.
 func (i UseCase[I, O]) Handler() http.Handler {
-	return nethttp.NewHandler(i.Interactor())
+	h := nethttp.NewHandler(i.Interactor(), i.handlerOptions()...)
+
+	// Wrapped so that swaggest can still find the underlying handler to set it up and document it
+	var middleware []func(next http.Handler) http.Handler
+	if i.deprecation != nil {
+		middleware = append(middleware, i.deprecation.Middleware)
+	}
+	if len(i.produces) > 0 {
+		middleware = append(middleware, i.producesMiddleware)
+	}
+	if i.uploads != nil || i.hasFiles() {
+		middleware = append(middleware, i.uploads.middleware)
+	}
+	if i.downloads() || i.paginates() || i.listQueried() {
+		middleware = append(middleware, requestMiddleware)
+	}
+	if len(middleware) > 0 {
+		return nethttp.WrapHandler(h, middleware...)
+	}
+
+	return h
 }
 
 type Interactor interface {
@@ -43,7 +76,7 @@ type Interactor interface {
 
 // interactor is a thin layer wrapping the generic around the interface expected by the underlying library
 func (i UseCase[I, O]) interactor() usecase.Interact {
-	return func(ctx context.Context, input, output interface{}) error {
+	return func(ctx context.Context, input, output interface{}) (err error) {
 		var in I
 		var out O
 		var ok bool
@@ -56,30 +89,62 @@ func (i UseCase[I, O]) interactor() usecase.Interact {
 			return errors.New("output could not be processed as generic")
 		}
 
-		// Now we'll generate a _new function_ based off of the middlewares
+		if sink := i.auditSink(ctx); sink != nil {
+			started := time.Now()
+			defer func() { i.record(ctx, sink, in, started, err) }()
+		}
+
+		defer func() {
+			if err != nil {
+				i.log(err, in)
+			}
+		}()
+
+		if err := i.pageRequest(&in); err != nil {
+			return err
+		}
+
+		if err := i.listQuery(ctx, &in); err != nil {
+			return err
+		}
+
+		if err := i.validate(ctx, in); err != nil {
+			return err
+		}
+
+		// Now we'll generate a _new function_ based off of the middlewares. Each stage is recovered so that
+		// a panic comes back as a PanicError whether or not the caller is an HTTP handler.
 		outContext := ctx
 		var outFn = func(ctx context.Context, input I, output O) error {
 
-			for _, v := range i.middleware {
-				var err error
-				if outContext, err = v(outContext, input, output); err != nil {
-					if i.logger != nil {
-						i.logger.Log(err.Error())
-					}
+			for k, v := range i.middleware {
+				v := v
+				err := recovered(middlewareStage(k, v), func() error {
+					var err error
+					outContext, err = v(outContext, input, output)
+					return err
+				})
+				if err != nil {
 					return err
 				}
 			}
 
-			return i.usecase(outContext, in, out)
-		}
+			if err := i.call(outContext, in, out); err != nil {
+				return err
+			}
+
+			if err := i.finishPage(outContext, out); err != nil {
+				return err
+			}
 
-		err := outFn(outContext, in, out)
+			if d, ok := any(out).(downloadable); ok {
+				return d.download().serve(outContext, i.contentType())
+			}
 
-		if err != nil && i.logger != nil {
-			i.logger.Log(err.Error())
+			return nil
 		}
 
-		return err
+		return outFn(outContext, in, out)
 	}
 }
 
@@ -90,6 +155,15 @@ func (i UseCase[I, O]) Interactor() usecase.Interactor {
 	if i.apiDecorationFunc != nil {
 		i.apiDecorationFunc(pu)
 	}
+	if i.deprecation != nil {
+		pu.SetIsDeprecated(true)
+	}
+	if i.validates() {
+		pu.SetExpectedErrors(append(pu.ExpectedErrors(), &ValidationError{})...)
+	}
+	if i.listQueried() {
+		pu.SetExpectedErrors(append(pu.ExpectedErrors(), &QueryError{})...)
+	}
 	return u
 }
 
@@ -105,6 +179,12 @@ func New[I any, O any](input I,
 	if reflect.ValueOf(output).Kind() != reflect.Ptr {
 		return UseCase[I, O]{}, errors.New("a pointer type must be provided as your output type for the interaction to apply it correctly")
 	}
+	if _, err := fileFields(reflect.TypeOf(input)); err != nil {
+		return UseCase[I, O]{}, err
+	}
+	if _, err := allowlistOf(reflect.TypeOf(input)); err != nil {
+		return UseCase[I, O]{}, err
+	}
 	return UseCase[I, O]{
 		input:             input,
 		output:            output,
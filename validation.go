@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/swaggest/rest"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+)
+
+// StageValidation is the PanicError stage of the input validators
+const StageValidation = "validation"
+
+// Validatable is implemented by input types with rules beyond their JSON Schema tags, such as the
+// relationship between two fields. Validate is called once the input has been decoded, before any
+// middleware.
+type Validatable interface {
+	Validate(ctx context.Context) error
+}
+
+// Validator checks an input on behalf of a use case, see UseCase.Validate
+type Validator[I any] func(ctx context.Context, input I) error
+
+// ValidationError is answered with 422 and the problems keyed by field in the error context, the way
+// swaggest reports JSON Schema validation failures
+type ValidationError struct {
+	Errors rest.ValidationErrors
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed"
+}
+
+func (e *ValidationError) Status() status.Code {
+	return status.InvalidArgument
+}
+
+func (e *ValidationError) HTTPStatus() int {
+	return http.StatusUnprocessableEntity
+}
+
+func (e *ValidationError) Fields() map[string]interface{} {
+	return e.Errors.Fields()
+}
+
+// FieldError reports a problem with a single field of the input from Validate or a Validator. Field
+// names follow swaggest's, the location and name of the field such as "query:limit" or "body:end".
+func FieldError(field, format string, args ...any) error {
+	return rest.ValidationErrors{field: {fmt.Sprintf(format, args...)}}
+}
+
+// Validate returns a copy of the use case which runs the validators, after the input's own Validate
+// method, before its middleware. Every validator runs so that all the problems are reported together.
+func (i UseCase[I, O]) Validate(validators ...Validator[I]) UseCase[I, O] {
+	i.validators = append(append([]Validator[I]{}, i.validators...), validators...)
+	return i
+}
+
+// validates reports whether the use case has anything to validate its input with
+func (i UseCase[I, O]) validates() bool {
+	var in I
+	if _, ok := any(in).(Validatable); ok {
+		return true
+	}
+	if _, ok := any(&in).(Validatable); ok {
+		return true
+	}
+
+	return len(i.validators) > 0 || i.hasFiles() || i.pageRequested()
+}
+
+// validate checks uploaded files against their limits then runs the input's Validate method and the
+// validators, merging their field errors. Any other error which carries a status of its own, such as a
+// lookup failing, is returned as it is.
+func (i UseCase[I, O]) validate(ctx context.Context, input I) error {
+	checks := i.validators
+	if v, ok := any(input).(Validatable); ok {
+		checks = append([]Validator[I]{func(ctx context.Context, _ I) error { return v.Validate(ctx) }}, checks...)
+	} else if v, ok := any(&input).(Validatable); ok {
+		checks = append([]Validator[I]{func(ctx context.Context, _ I) error { return v.Validate(ctx) }}, checks...)
+	}
+	if i.hasFiles() {
+		checks = append([]Validator[I]{func(ctx context.Context, input I) error { return checkFiles(input) }}, checks...)
+	}
+
+	fields := rest.ValidationErrors{}
+	for k, check := range checks {
+		k, check := k, check
+		err := recovered(func() string { return fmt.Sprintf("%s[%d]", StageValidation, k) }, func() error {
+			return check(ctx, input)
+		})
+		if err == nil {
+			continue
+		}
+
+		var (
+			ve  *ValidationError
+			re  rest.ValidationErrors
+			ws  rest.ErrWithCanonicalStatus
+			whs rest.ErrWithHTTPStatus
+		)
+		switch {
+		case errors.As(err, &ve):
+			merge(fields, ve.Errors)
+		case errors.As(err, &re):
+			merge(fields, re)
+		case errors.As(err, &ws), errors.As(err, &whs):
+			return err
+		default:
+			fields["input"] = append(fields["input"], err.Error())
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Errors: fields}
+}
+
+func merge(into, from rest.ValidationErrors) {
+	for k, v := range from {
+		into[k] = append(into[k], v...)
+	}
+}
@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/swaggest/rest/web"
+	"github.com/swaggest/usecase/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bookingInput struct {
+	Start time.Time `json:"start" required:"true"`
+	End   time.Time `json:"end" required:"true"`
+	Room  string    `json:"room" required:"true"`
+}
+
+func (b bookingInput) Validate(ctx context.Context) error {
+	if !b.End.After(b.Start) {
+		return FieldError("body:end", "must be after start")
+	}
+
+	return nil
+}
+
+type bookingOutput struct {
+	Room string `json:"room"`
+}
+
+func TestUseCase_Validate(tt *testing.T) {
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	lookupFailed := status.Wrap(errors.New("rooms unavailable"), status.Unavailable)
+
+	tests := []struct {
+		name        string
+		body        string
+		validators  []Validator[bookingInput]
+		wantCode    int
+		wantContext map[string][]string
+		wantCalled  bool
+	}{
+		{
+			name:       "valid",
+			body:       `{"start":"2026-01-02T10:00:00Z","end":"2026-01-02T11:00:00Z","room":"blue"}`,
+			wantCode:   http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:        "input Validate method",
+			body:        `{"start":"2026-01-02T10:00:00Z","end":"2026-01-02T09:00:00Z","room":"blue"}`,
+			wantCode:    http.StatusUnprocessableEntity,
+			wantContext: map[string][]string{"body:end": {"must be after start"}},
+		},
+		{
+			name: "registered validators report together",
+			body: `{"start":"2026-01-02T10:00:00Z","end":"2026-01-02T09:00:00Z","room":"red"}`,
+			validators: []Validator[bookingInput]{
+				func(ctx context.Context, input bookingInput) error {
+					if input.Room == "red" {
+						return FieldError("body:room", "room %s is closed", input.Room)
+					}
+					return nil
+				},
+				func(ctx context.Context, input bookingInput) error {
+					if input.Start.Equal(start) {
+						return errors.New("bookings open at noon")
+					}
+					return nil
+				},
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantContext: map[string][]string{
+				"body:end":  {"must be after start"},
+				"body:room": {"room red is closed"},
+				"input":     {"bookings open at noon"},
+			},
+		},
+		{
+			name: "errors with a status are kept",
+			body: `{"start":"2026-01-02T10:00:00Z","end":"2026-01-02T11:00:00Z","room":"blue"}`,
+			validators: []Validator[bookingInput]{
+				func(ctx context.Context, input bookingInput) error { return lookupFailed },
+			},
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			called := false
+			middleware := func(ctx context.Context, input bookingInput, output *bookingOutput) (context.Context, error) {
+				called = true
+				return ctx, nil
+			}
+			uc, err := New(bookingInput{}, &bookingOutput{}, func(ctx context.Context, input bookingInput, output *bookingOutput) error {
+				output.Room = input.Room
+				return nil
+			}, nil, nil, middleware)
+			t.R.Nil(err)
+			uc = uc.Validate(test.validators...)
+
+			s := web.DefaultService()
+			s.Method(http.MethodPost, "/bookings", uc.Handler())
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/bookings", strings.NewReader(test.body)))
+
+			t.A.Equal(test.wantCode, res.Code, res.Body.String())
+			t.A.Equal(test.wantCalled, called)
+
+			if test.wantContext != nil {
+				var body struct {
+					Status  string              `json:"status"`
+					Error   string              `json:"error"`
+					Context map[string][]string `json:"context"`
+				}
+				t.R.Nil(json.Unmarshal(res.Body.Bytes(), &body))
+				t.A.Equal("INVALID_ARGUMENT", body.Status)
+				t.A.Equal("validation failed", body.Error)
+				t.A.Equal(test.wantContext, body.Context)
+			}
+		})
+	}
+}
+
+func TestUseCase_Validate_schema(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+
+	uc, err := New(bookingInput{}, &bookingOutput{}, func(ctx context.Context, input bookingInput, output *bookingOutput) error {
+		return nil
+	}, nil, nil)
+	t.R.Nil(err)
+
+	s := web.DefaultService()
+	s.Method(http.MethodPost, "/bookings", uc.Handler())
+
+	spec, err := json.Marshal(s.OpenAPI)
+	t.R.Nil(err)
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]any `json:"responses"`
+		} `json:"paths"`
+	}
+	t.R.Nil(json.Unmarshal(spec, &doc))
+	t.A.Contains(doc.Paths["/bookings"]["post"].Responses, "422")
+}
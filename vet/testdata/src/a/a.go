@@ -0,0 +1,53 @@
+package a
+
+import (
+	"context"
+	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/node"
+)
+
+type Place struct {
+	Place string `path:"place"`
+}
+
+type WalkRequest struct {
+	Place
+	Times int    `json:"times" path:"times" requird:"true"`      // want `struct tag requird on Times looks like a misspelling of required`
+	Dog   string `json:"dog" yaml:"dog" env:"DOG" minlength:"1"` // want `struct tag minlength on Dog looks like a misspelling of minLength`
+	Leash Leash  `json:"leash"`
+}
+
+type Leash struct {
+	Length int `json:"length" nulable:"true"` // want `struct tag nulable on Length looks like a misspelling of nullable`
+}
+
+type WalkResponse struct {
+	Walked bool `json:"walked" required:"yes"` // want `struct tag required:"yes" on Walked is not a boolean`
+}
+
+func walk(ctx context.Context, input WalkRequest, output *WalkResponse) error { return nil }
+
+func byValue(ctx context.Context, input WalkRequest, output WalkResponse) error { return nil }
+
+func routes() *node.Node {
+	uc, _ := usecase.New(WalkRequest{}, &WalkResponse{}, walk)
+	_, _ = usecase.New(WalkRequest{}, WalkResponse{}, byValue) // want `output a.WalkResponse passed to usecase.New is not a pointer so the use case can't fill it in`
+
+	uc.Use(func(ctx context.Context, input WalkRequest, output *WalkResponse) (context.Context, error) { // want `result of UseCase.Use is discarded, it returns a copy of the use case with the change`
+		return ctx, nil
+	})
+	uc.Visibility("internal") // want `result of UseCase.Visibility is discarded, it returns a copy of the use case with the change`
+	uc = uc.Visibility("internal")
+
+	return &node.Node{
+		Tree: map[node.Route]map[string]node.Handler{
+			"/{place}/{times:[0-9]+}": {
+				"GET": uc,
+			},
+			"/{place}/{dog}": {
+				"GET":  uc,                        // want `route /{place}/{dog} has path parameter dog but a.WalkRequest has no path:"dog" field`
+				"POST": uc.Visibility("internal"), // want `route /{place}/{dog} has path parameter dog but a.WalkRequest has no path:"dog" field`
+			},
+		},
+	}
+}
@@ -0,0 +1,14 @@
+// Package node is a stub of the parts of github.com/muverum/usecase/node the analyzer looks at
+package node
+
+import "net/http"
+
+type Route string
+
+type Handler interface {
+	Handler() http.Handler
+}
+
+type Node struct {
+	Tree map[Route]map[string]Handler
+}
@@ -0,0 +1,23 @@
+// Package usecase is a stub of the parts of github.com/muverum/usecase the analyzer looks at
+package usecase
+
+import (
+	"context"
+	"net/http"
+)
+
+type UseCaseFunc[I any, O any] func(ctx context.Context, input I, output O) error
+
+type Middleware[I any, O any] func(ctx context.Context, input I, output O) (context.Context, error)
+
+type UseCase[I any, O any] struct{}
+
+func (i UseCase[I, O]) Use(middlewares ...Middleware[I, O]) UseCase[I, O] { return i }
+
+func (i UseCase[I, O]) Visibility(visibility string) UseCase[I, O] { return i }
+
+func (i UseCase[I, O]) Handler() http.Handler { return nil }
+
+func New[I any, O any](input I, output O, interactor UseCaseFunc[I, O]) (UseCase[I, O], error) {
+	return UseCase[I, O]{}, nil
+}
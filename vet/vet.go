@@ -0,0 +1,410 @@
+// Package vet is a go/analysis analyzer for mistakes which compile but leave a use case quietly broken:
+// misspelled swaggest struct tags, route path parameters the input can't receive, non-pointer outputs and
+// discarded copies of a use case.
+package vet
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ast/inspector"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	usecasePath = "github.com/muverum/usecase"
+	nodePath    = usecasePath + "/node"
+)
+
+const doc = `check use case input and output types, node routes and UseCase copies
+
+Reports struct tags on use case inputs and outputs which look like misspelled swaggest tags (accept
+others with -accept), path parameters of node.Route keys without a matching path field on the use case
+input, non-pointer outputs passed to usecase.New and UseCase methods such as Use whose returned copy
+is discarded.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "usecasevet",
+	Doc:      doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// extraTags are accepted as they are, for tag keys of other libraries which look like swaggest's
+var extraTags string
+
+func init() {
+	Analyzer.Flags.StringVar(&extraTags, "accept", "", "comma separated struct tag keys to accept besides the known ones")
+}
+
+// swaggestTags are the struct tag keys read by swaggest's request decoder and schema reflector, along
+// with the tags of this package's upload limits, list queries and redaction
+var swaggestTags = map[string]bool{
+	"json": true, "query": true, "path": true, "header": true, "cookie": true, "formData": true, "form": true,
+	"file": true, "contentType": true, "required": true, "nullable": true, "deprecated": true, "title": true,
+	"description": true, "default": true, "example": true, "examples": true, "enum": true, "format": true,
+	"pattern": true, "minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	"multipleOf": true, "minLength": true, "maxLength": true, "minItems": true, "maxItems": true,
+	"uniqueItems": true, "minProperties": true, "maxProperties": true, "readOnly": true, "writeOnly": true,
+	"const": true, "type": true, "additionalProperties": true, "contentEncoding": true,
+	"contentMediaType": true, "collectionFormat": true, "explode": true, "style": true,
+	"maxSize": true, "accept": true, "filter": true, "sort": true, "redact": true,
+}
+
+// otherTags belong to common libraries and are close enough to a swaggest tag to be mistaken for a typo
+var otherTags = map[string]bool{
+	"yaml": true, "xml": true, "db": true, "env": true, "bson": true, "toml": true, "mapstructure": true,
+	"validate": true, "binding": true, "gorm": true, "csv": true, "msgpack": true, "protobuf": true, "url": true,
+	"schema": true,
+}
+
+var boolTags = []string{"required", "nullable", "deprecated", "readOnly", "writeOnly", "uniqueItems"}
+
+var routeParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?}`)
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	accepted := map[string]bool{}
+	for _, v := range strings.Split(extraTags, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			accepted[v] = true
+		}
+	}
+
+	c := &checker{pass: pass, accepted: accepted, checked: map[types.Type]bool{}}
+
+	in := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	filter := []ast.Node{(*ast.CallExpr)(nil), (*ast.CompositeLit)(nil), (*ast.ExprStmt)(nil)}
+	in.Preorder(filter, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			c.newCall(n)
+		case *ast.CompositeLit:
+			c.routes(n)
+		case *ast.ExprStmt:
+			c.discarded(n)
+		}
+	})
+
+	return nil, nil
+}
+
+type checker struct {
+	pass     *analysis.Pass
+	accepted map[string]bool
+	checked  map[types.Type]bool
+}
+
+// newCall checks the output of usecase.New is a pointer and the tags of its input and output types
+func (c *checker) newCall(call *ast.CallExpr) {
+	fn, ok := calledFunc(c.pass, call)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != usecasePath || fn.Name() != "New" || len(call.Args) < 2 {
+		return
+	}
+
+	results, ok := c.pass.TypesInfo.TypeOf(call).(*types.Tuple)
+	if !ok || results.Len() == 0 {
+		return
+	}
+	input, output, ok := useCaseArgs(results.At(0).Type())
+	if !ok {
+		return
+	}
+
+	if _, ok := output.Underlying().(*types.Pointer); !ok {
+		c.pass.Reportf(call.Args[1].Pos(), "output %s passed to usecase.New is not a pointer so the use case can't fill it in", output)
+	}
+
+	c.tags(input)
+	c.tags(output)
+}
+
+// tags reports misspelled and malformed struct tags on the fields of t declared in the package, and on
+// the struct types of its fields
+func (c *checker) tags(t types.Type) {
+	t = deref(t)
+	if c.checked[t] {
+		return
+	}
+	c.checked[t] = true
+
+	s, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return
+	}
+
+	for k := 0; k < s.NumFields(); k++ {
+		field := s.Field(k)
+		if field.Pkg() != c.pass.Pkg {
+			continue
+		}
+
+		for _, tag := range parseTag(s.Tag(k)) {
+			switch {
+			case swaggestTags[tag.key] || otherTags[tag.key] || c.accepted[tag.key]:
+			case suggestion(tag.key) != "":
+				c.pass.Reportf(field.Pos(), "struct tag %s on %s looks like a misspelling of %s", tag.key, field.Name(), suggestion(tag.key))
+			}
+
+			for _, b := range boolTags {
+				if tag.key != b {
+					continue
+				}
+				if _, err := strconv.ParseBool(tag.value); err != nil {
+					c.pass.Reportf(field.Pos(), "struct tag %s:%q on %s is not a boolean", tag.key, tag.value, field.Name())
+				}
+			}
+		}
+
+		switch ft := deref(field.Type()).Underlying().(type) {
+		case *types.Slice:
+			c.tags(ft.Elem())
+		case *types.Array:
+			c.tags(ft.Elem())
+		case *types.Map:
+			c.tags(ft.Elem())
+		default:
+			c.tags(field.Type())
+		}
+	}
+}
+
+// routes checks the path parameters of node.Route keys have a path field on the input of their use cases
+func (c *checker) routes(lit *ast.CompositeLit) {
+	m, ok := c.pass.TypesInfo.TypeOf(lit).Underlying().(*types.Map)
+	if !ok || !isNamed(m.Key(), nodePath, "Route") {
+		return
+	}
+
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key := c.pass.TypesInfo.Types[kv.Key].Value
+		if key == nil || key.Kind() != constant.String {
+			continue
+		}
+		route := constant.StringVal(key)
+		params := routeParam.FindAllStringSubmatch(route, -1)
+
+		verbs, ok := kv.Value.(*ast.CompositeLit)
+		if !ok || len(params) == 0 {
+			continue
+		}
+
+		for _, v := range verbs.Elts {
+			verb, ok := v.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			input, _, ok := useCaseArgs(c.pass.TypesInfo.TypeOf(verb.Value))
+			if !ok {
+				continue
+			}
+
+			fields := pathFields(input, map[types.Type]bool{})
+			for _, p := range params {
+				if !fields[p[1]] {
+					c.pass.Reportf(verb.Value.Pos(), "route %s has path parameter %s but %s has no path:%q field", route, p[1], input, p[1])
+				}
+			}
+		}
+	}
+}
+
+// discarded reports calls of UseCase methods returning a changed copy whose result is thrown away
+func (c *checker) discarded(stmt *ast.ExprStmt) {
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	selection, ok := c.pass.TypesInfo.Selections[sel]
+	if !ok || selection.Kind() != types.MethodVal {
+		return
+	}
+
+	if _, _, ok := useCaseArgs(deref(selection.Recv())); !ok {
+		return
+	}
+	results := selection.Type().(*types.Signature).Results()
+	if results.Len() != 1 {
+		return
+	}
+	if _, _, ok := useCaseArgs(results.At(0).Type()); !ok {
+		return
+	}
+
+	c.pass.Reportf(call.Pos(), "result of UseCase.%s is discarded, it returns a copy of the use case with the change", sel.Sel.Name)
+}
+
+func calledFunc(pass *analysis.Pass, call *ast.CallExpr) (*types.Func, bool) {
+	fun := astutil.Unparen(call.Fun)
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+
+	var id *ast.Ident
+	switch f := fun.(type) {
+	case *ast.Ident:
+		id = f
+	case *ast.SelectorExpr:
+		id = f.Sel
+	default:
+		return nil, false
+	}
+
+	fn, ok := pass.TypesInfo.Uses[id].(*types.Func)
+	return fn, ok
+}
+
+// useCaseArgs returns the input and output types of an instantiated usecase.UseCase
+func useCaseArgs(t types.Type) (types.Type, types.Type, bool) {
+	named, ok := t.(*types.Named)
+	if !ok || !isNamed(named, usecasePath, "UseCase") || named.TypeArgs().Len() != 2 {
+		return nil, nil, false
+	}
+
+	return named.TypeArgs().At(0), named.TypeArgs().At(1), true
+}
+
+func isNamed(t types.Type, path, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+
+	return obj.Pkg() != nil && obj.Pkg().Path() == path && obj.Name() == name
+}
+
+func deref(t types.Type) types.Type {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		return p.Elem()
+	}
+
+	return t
+}
+
+// pathFields collects the path tag names of a struct, including those of its embedded structs
+func pathFields(t types.Type, seen map[types.Type]bool) map[string]bool {
+	fields := map[string]bool{}
+	t = deref(t)
+	if seen[t] {
+		return fields
+	}
+	seen[t] = true
+
+	s, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return fields
+	}
+
+	for k := 0; k < s.NumFields(); k++ {
+		for _, tag := range parseTag(s.Tag(k)) {
+			if tag.key == "path" {
+				fields[strings.Split(tag.value, ",")[0]] = true
+			}
+		}
+		if s.Field(k).Embedded() {
+			for name := range pathFields(s.Field(k).Type(), seen) {
+				fields[name] = true
+			}
+		}
+	}
+
+	return fields
+}
+
+type tagPair struct {
+	key, value string
+}
+
+// parseTag splits a struct tag into its key:"value" pairs the way reflect.StructTag.Lookup reads them,
+// stopping at the first malformed pair as go vet's structtag check already reports those
+func parseTag(tag string) []tagPair {
+	var pairs []tagPair
+	for tag != "" {
+		tag = strings.TrimLeft(tag, " ")
+		k := 0
+		for k < len(tag) && tag[k] > ' ' && tag[k] != ':' && tag[k] != '"' && tag[k] != 0x7f {
+			k++
+		}
+		if k == 0 || k+1 >= len(tag) || tag[k] != ':' || tag[k+1] != '"' {
+			break
+		}
+		key := tag[:k]
+		tag = tag[k+1:]
+
+		k = 1
+		for k < len(tag) && tag[k] != '"' {
+			if tag[k] == '\\' {
+				k++
+			}
+			k++
+		}
+		if k >= len(tag) {
+			break
+		}
+		value, err := strconv.Unquote(tag[:k+1])
+		if err != nil {
+			break
+		}
+		tag = tag[k+1:]
+
+		pairs = append(pairs, tagPair{key, value})
+	}
+
+	return pairs
+}
+
+// suggestion is the swaggest tag an unknown key is most likely a misspelling of, if any
+func suggestion(key string) string {
+	best, bestDistance := "", 3
+	for known := range swaggestTags {
+		d := distance(strings.ToLower(key), strings.ToLower(known))
+		limit := 2
+		if len(known) <= 4 {
+			limit = 1
+		}
+		if d <= limit && (d < bestDistance || d == bestDistance && known < best) {
+			best, bestDistance = known, d
+		}
+	}
+
+	return best
+}
+
+// distance is the Levenshtein distance between two strings
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for k := range previous {
+		previous[k] = k
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,10 @@
+package vet
+
+import (
+	"golang.org/x/tools/go/analysis/analysistest"
+	"testing"
+)
+
+func TestAnalyzer(tt *testing.T) {
+	analysistest.Run(tt, analysistest.TestData(), Analyzer, "a")
+}
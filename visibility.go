@@ -0,0 +1,45 @@
+package usecase
+
+import (
+	"github.com/swaggest/openapi-go"
+	"github.com/swaggest/openapi-go/openapi3"
+	"github.com/swaggest/rest/nethttp"
+)
+
+// VisibilityExtension is the OpenAPI operation extension recording who an operation is meant for
+const VisibilityExtension = "x-visibility"
+
+const (
+	VisibilityPublic   = "public"
+	VisibilityPartner  = "partner"
+	VisibilityInternal = "internal"
+)
+
+// Visibility returns a copy of the use case whose OpenAPI operation records the audience it is meant for,
+// so that filtered documents can leave it out. Use cases without one are public.
+func (i UseCase[I, O]) Visibility(visibility string) UseCase[I, O] {
+	i.visibility = visibility
+	return i
+}
+
+// AnnotateVisibility sets the visibility extension on an operation
+func AnnotateVisibility(visibility string) func(oc openapi.OperationContext) error {
+	return func(oc openapi.OperationContext) error {
+		if o3, ok := oc.(openapi3.OperationExposer); ok && visibility != "" {
+			o3.Operation().WithMapOfAnythingItem(VisibilityExtension, visibility)
+		}
+
+		return nil
+	}
+}
+
+func (i UseCase[I, O]) handlerOptions() []func(h *nethttp.Handler) {
+	var options []func(h *nethttp.Handler)
+	if i.visibility != "" {
+		options = append(options, nethttp.AnnotateOpenAPIOperation(AnnotateVisibility(i.visibility)))
+	}
+	options = append(options, i.fileHandlerOptions()...)
+	options = append(options, i.listQueryHandlerOptions()...)
+
+	return options
+}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/muverum/usecase"
+	"github.com/swaggest/rest"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Handler hosts a use case behind a WebSocket connection. Every inbound text message is decoded and
+// validated into the input type, run through the use case middleware chain and answered with either
+// the JSON encoded output or a rest.ErrResponse.
+type Handler[I any, O any] struct {
+	UseCase  usecase.UseCase[I, O]
+	Upgrader websocket.Upgrader
+	// MaxMessageSize is the largest inbound message in bytes, the connection is closed when exceeded
+	MaxMessageSize int64
+	// PingInterval is how often a ping is sent to the peer, it must be shorter than PongWait. No pings are
+	// sent when it isn't positive.
+	PingInterval time.Duration
+	// PongWait is how long the connection may go without a pong (or any message) before it is dropped, never
+	// when it isn't positive
+	PongWait  time.Duration
+	WriteWait time.Duration
+}
+
+func New[I any, O any](uc usecase.UseCase[I, O], options ...func(h *Handler[I, O])) *Handler[I, O] {
+	h := &Handler[I, O]{
+		UseCase:        uc,
+		MaxMessageSize: 64 * 1024,
+		PingInterval:   50 * time.Second,
+		PongWait:       60 * time.Second,
+		WriteWait:      10 * time.Second,
+	}
+
+	for _, v := range options {
+		v(h)
+	}
+
+	return h
+}
+
+// Handler allows the WebSocket loop to be placed in a node.Node Tree like any other use case.
+// It should be registered under http.MethodGet since that is the verb of the upgrade request.
+func (h *Handler[I, O]) Handler() http.Handler {
+	return http.HandlerFunc(h.ServeHTTP)
+}
+
+// Transport labels the route in node.Node Routes()
+func (h *Handler[I, O]) Transport() string {
+	return "websocket"
+}
+
+func (h *Handler[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		return
+	}
+	defer conn.Close()
+
+	c := &connection{conn: conn, writeWait: h.WriteWait}
+
+	conn.SetReadLimit(h.MaxMessageSize)
+	_ = conn.SetReadDeadline(h.readDeadline())
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(h.readDeadline())
+	})
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	if h.PingInterval > 0 {
+		go c.keepalive(ctx, h.PingInterval)
+	}
+
+	for {
+		var message []byte
+		if _, message, err = conn.ReadMessage(); err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(h.readDeadline())
+
+		if err = c.write(h.handle(ctx, message)); err != nil {
+			return
+		}
+	}
+}
+
+// handle processes a single inbound message and returns the value to send back
+func (h *Handler[I, O]) handle(ctx context.Context, message []byte) any {
+	in, err := h.UseCase.DecodeJSON(message)
+	if err != nil {
+		_, er := rest.Err(err)
+		return er
+	}
+
+	out, err := h.UseCase.Execute(ctx, in)
+	if err != nil {
+		_, er := rest.Err(err)
+		return er
+	}
+
+	return out
+}
+
+// connection serializes writes since gorilla connections only support a single concurrent writer
+type connection struct {
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	writeWait time.Duration
+}
+
+func (c *connection) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// readDeadline is when the connection is dropped unless something is read, the zero time meaning never
+func (h *Handler[I, O]) readDeadline() time.Time {
+	if h.PongWait <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(h.PongWait)
+}
+
+func (c *connection) keepalive(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.writeWait))
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package ws
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/muverum/usecase"
+	"github.com/muverum/usecase/node"
+	"github.com/swaggest/rest/web"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type echoRequest struct {
+	Text string `json:"text" required:"true" minLength:"3"`
+}
+
+type echoResponse struct {
+	Echo  string `json:"echo"`
+	Calls int    `json:"calls"`
+}
+
+func TestHandler_ServeHTTP(tt *testing.T) {
+	counted := func(ctx context.Context, input echoRequest, output *echoResponse) (context.Context, error) {
+		output.Calls++
+		return ctx, nil
+	}
+
+	uc, err := usecase.New(echoRequest{}, &echoResponse{}, func(ctx context.Context, input echoRequest, output *echoResponse) error {
+		output.Echo = strings.ToUpper(input.Text)
+		return nil
+	}, nil, nil, counted)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	service := web.DefaultService()
+	n := node.New(service)
+	n.Root = "/chat"
+	n.Tree = map[node.Route]map[string]node.Handler{
+		"/echo": {
+			http.MethodGet: New(uc, func(h *Handler[echoRequest, *echoResponse]) {
+				h.MaxMessageSize = 128
+			}),
+		},
+	}
+	if err = n.Mount(); err != nil {
+		tt.Fatal(err)
+	}
+
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		message       string
+		assertionFunc func(t *wrapt.T, conn *websocket.Conn)
+	}{
+		{
+			name:    "valid message runs the chain",
+			message: `{"text":"woof"}`,
+			assertionFunc: func(t *wrapt.T, conn *websocket.Conn) {
+				var out echoResponse
+				t.R.Nil(conn.ReadJSON(&out))
+				t.A.Equal("WOOF", out.Echo)
+				t.A.Equal(1, out.Calls)
+			},
+		},
+		{
+			name:    "schema violations are reported without closing",
+			message: `{"text":"no"}`,
+			assertionFunc: func(t *wrapt.T, conn *websocket.Conn) {
+				var out map[string]any
+				t.R.Nil(conn.ReadJSON(&out))
+				t.A.Equal("INVALID_ARGUMENT", out["status"])
+				t.A.Contains(out, "context")
+
+				t.R.Nil(conn.WriteMessage(websocket.TextMessage, []byte(`{"text":"still here"}`)))
+				var next echoResponse
+				t.R.Nil(conn.ReadJSON(&next))
+				t.A.Equal("STILL HERE", next.Echo)
+			},
+		},
+		{
+			name:    "oversized messages close the connection",
+			message: `{"text":"` + strings.Repeat("a", 256) + `"}`,
+			assertionFunc: func(t *wrapt.T, conn *websocket.Conn) {
+				_, _, err := conn.ReadMessage()
+				t.A.True(websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/chat/echo", nil)
+			t.R.Nil(err)
+			defer conn.Close()
+
+			t.R.Nil(conn.WriteMessage(websocket.TextMessage, []byte(test.message)))
+
+			if test.assertionFunc != nil {
+				test.assertionFunc(t, conn)
+			}
+		})
+	}
+
+	tt.Run("listed in routes", func(tt *testing.T) {
+		t := wrapt.WrapT(tt)
+		t.A.Contains(n.Routes(), "\t/echo\tGET\t(websocket)")
+	})
+}
+
+func TestHandler_NotUpgraded(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	uc, _ := usecase.New(echoRequest{}, &echoResponse{}, func(ctx context.Context, input echoRequest, output *echoResponse) error {
+		return nil
+	}, nil, nil)
+
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/echo", New(uc).Handler())
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/echo", nil))
+
+	t.A.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_noKeepalive(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	uc, err := usecase.New(echoRequest{}, &echoResponse{}, func(ctx context.Context, input echoRequest, output *echoResponse) error {
+		output.Echo = input.Text
+		return nil
+	}, nil, nil)
+	t.R.Nil(err)
+
+	server := httptest.NewServer(New(uc, func(h *Handler[echoRequest, *echoResponse]) {
+		h.PingInterval = 0
+		h.PongWait = -time.Second
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	t.R.Nil(err)
+	defer conn.Close()
+
+	t.R.Nil(conn.WriteMessage(websocket.TextMessage, []byte(`{"text":"woof"}`)))
+	var out echoResponse
+	t.R.Nil(conn.ReadJSON(&out))
+	t.A.Equal("woof", out.Echo)
+}